@@ -10,9 +10,11 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var dbClient *mongo.Client = getDbClient()
+var dbBackend *engine.Backend = engine.NewBackend("MongoDB", checkDb, nil, nil).MarkCritical()
 var AuthorizedUsers []int64
 var AuthorizedChats []int64
 
@@ -32,6 +34,22 @@ func getDbClient() *mongo.Client {
 	return client
 }
 
+// checkDb : the version is left out when the user may not run buildInfo, the ping alone decides if the database is up
+func checkDb(ctx context.Context) (string, error) {
+	err := dbClient.Ping(ctx, readpref.Primary())
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version string `bson:"version"`
+	}
+	err = dbClient.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info)
+	if err != nil {
+		return "", nil
+	}
+	return info.Version, nil
+}
+
 func IsUserAuthorized(userId int64) bool {
 	for _, i := range AuthorizedUsers {
 		if i == userId {
@@ -178,6 +196,7 @@ func init() {
 	engine.L().Info("Initializing database..")
 	InitChats()
 	InitUsers()
+	MigrateSecrets()
 	for _, i := range utils.GetSudoUsers() {
 		AuthorizeUserLocal(i)
 	}
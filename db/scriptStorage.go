@@ -2,17 +2,32 @@ package db
 
 import (
 	"MirrorBotGo/engine"
+	"MirrorBotGo/utils"
 	"context"
 	"fmt"
+	"github.com/PaulSonOfLars/gotgbot/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"regexp"
+	"sync"
 	"time"
 )
 
-func UpdateExtractor(regex string, script string) error {
-	engine.L().Infof("updating extractor code %s : %s", regex, script)
+func getExtractorScript(regex string) (string, bool) {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
+	var result struct {
+		Script string `bson:"script"`
+	}
+	err := collection.FindOne(Ctx, bson.M{"regex": regex}).Decode(&result)
+	if err != nil {
+		return "", false
+	}
+	return result.Script, true
+}
+
+func setExtractorScript(regex string, script string) error {
 	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
@@ -21,16 +36,31 @@ func UpdateExtractor(regex string, script string) error {
 		"regex": regex,
 	}
 	_, err := collection.UpdateOne(Ctx, filter, bson.D{{
-		"$set", bson.M{
+		Key: "$set", Value: bson.M{
 			"regex":  regex,
 			"script": script,
 		},
 	}}, opts)
+	invalidateExtractorCache()
 	return err
 }
 
-func RemoveExtractor(regex string) error {
+func UpdateExtractor(regex string, script string, author *gotgbot.User) error {
+	engine.L().Infof("updating extractor code %s", regex)
+	previous, _ := getExtractorScript(regex)
+	err := setExtractorScript(regex, script)
+	if err != nil {
+		return err
+	}
+	return recordVersion(VersionKindExtractor, regex, VersionActionUpdate, previous, script, author)
+}
+
+func RemoveExtractor(regex string, author *gotgbot.User) error {
 	engine.L().Infof("deleting extractor code %s", regex)
+	previous, found := getExtractorScript(regex)
+	if !found {
+		return fmt.Errorf("extractor not found")
+	}
 	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
@@ -38,59 +68,258 @@ func RemoveExtractor(regex string) error {
 		"regex": regex,
 	}
 	_, err := collection.DeleteOne(Ctx, filter)
-	return err
+	invalidateExtractorCache()
+	if err != nil {
+		return err
+	}
+	err = deleteExtractorTests(regex)
+	if err != nil {
+		engine.L().Errorf("RemoveExtractor: failed to delete the tests of %s: %v", regex, err)
+	}
+	return recordVersion(VersionKindExtractor, regex, VersionActionRemove, previous, "", author)
 }
 
-func GetExtractors() (map[string]string, error) {
-	engine.L().Infof("getting extractors")
+// SetExtractorDisabled : disabled extractors stay stored with their tests and history but are never matched
+func SetExtractorDisabled(regex string, disabled bool, author *gotgbot.User) error {
+	engine.L().Infof("setting extractor %s disabled: %t", regex, disabled)
+	script, found := getExtractorScript(regex)
+	if !found {
+		return fmt.Errorf("extractor not found")
+	}
 	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
-	cur, err := collection.Find(Ctx, bson.D{})
+	filter := bson.M{
+		"regex": regex,
+	}
+	_, err := collection.UpdateOne(Ctx, filter, bson.D{{
+		Key: "$set", Value: bson.M{
+			"disabled": disabled,
+		},
+	}})
+	invalidateExtractorCache()
+	if err != nil {
+		return err
+	}
+	action := VersionActionEnable
+	if disabled {
+		action = VersionActionDisable
+	}
+	return recordVersion(VersionKindExtractor, regex, action, script, script, author)
+}
+
+func GetDisabledExtractors() ([]string, error) {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
+	cur, err := collection.Find(Ctx, bson.M{"disabled": true})
 	if err != nil {
 		return nil, err
 	}
-	var rtr = make(map[string]string)
 	defer func(cur *mongo.Cursor, ctx context.Context) {
 		err := cur.Close(ctx)
 		if err != nil {
-			engine.L().Errorf("getExtractors: failed to close cursor: %v", err)
+			engine.L().Errorf("getDisabledExtractors: failed to close cursor: %v", err)
 		}
 	}(cur, Ctx)
+	var disabled []string
 	for cur.Next(Ctx) {
 		var result bson.M
 		err := cur.Decode(&result)
 		if err != nil {
 			engine.L().Error(err)
-		} else {
-			if result["regex"] != nil && result["script"] != nil {
-				rtr[fmt.Sprint(result["regex"])] = fmt.Sprint(result["script"])
-			}
+		} else if result["regex"] != nil {
+			disabled = append(disabled, fmt.Sprint(result["regex"]))
 		}
 	}
-	return rtr, nil
+	return disabled, nil
 }
 
-func IsExtractable(link string) bool {
-	extractors, err := GetExtractors()
+// extractorCache : compiled enabled extractors in run order, dropped on every write and reloaded lazily
+var extractorCache []*engine.Extractor
+var extractorCacheMut sync.Mutex
+
+func invalidateExtractorCache() {
+	extractorCacheMut.Lock()
+	defer extractorCacheMut.Unlock()
+	extractorCache = nil
+}
+
+func loadExtractors() ([]*engine.Extractor, error) {
+	engine.L().Infof("loading extractors")
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
+	cur, err := collection.Find(Ctx, bson.D{})
 	if err != nil {
-		engine.L().Error(err)
-		return false
+		return nil, err
 	}
-	for regex, _ := range extractors {
-		matched, err := regexp.MatchString(regex, link)
+	defer func(cur *mongo.Cursor, ctx context.Context) {
+		err := cur.Close(ctx)
+		if err != nil {
+			engine.L().Errorf("loadExtractors: failed to close cursor: %v", err)
+		}
+	}(cur, Ctx)
+	var extractors []*engine.Extractor
+	for cur.Next(Ctx) {
+		var result struct {
+			Regex    string `bson:"regex"`
+			Script   string `bson:"script"`
+			Priority int    `bson:"priority"`
+			Disabled bool   `bson:"disabled"`
+		}
+		err := cur.Decode(&result)
 		if err != nil {
+			engine.L().Error(err)
 			continue
 		}
-		if matched {
-			return true
+		if result.Disabled || result.Regex == "" || result.Script == "" {
+			continue
 		}
+		extractor, err := engine.NewExtractor(result.Regex, result.Script, result.Priority)
+		if err != nil {
+			engine.L().Errorf("skipping extractor: %v", err)
+			continue
+		}
+		extractors = append(extractors, extractor)
 	}
-	return false
+	engine.SortExtractors(extractors)
+	return extractors, nil
 }
 
-func UpdateSecret(key string, value string) error {
-	engine.L().Infof("updating secret %s : %s", key, value)
+// GetExtractors : enabled extractors sorted by priority, served from the cache after the first load
+func GetExtractors() ([]*engine.Extractor, error) {
+	extractorCacheMut.Lock()
+	defer extractorCacheMut.Unlock()
+	if extractorCache == nil {
+		extractors, err := loadExtractors()
+		if err != nil {
+			return nil, err
+		}
+		extractorCache = extractors
+	}
+	return append([]*engine.Extractor(nil), extractorCache...), nil
+}
+
+// GetExtractor : looked up in mongo rather than the cache, which only holds the enabled ones, so disabled extractors can
+// still be viewed and tested while they are being fixed
+func GetExtractor(regex string) (*engine.Extractor, error) {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
+	var result struct {
+		Regex    string `bson:"regex"`
+		Script   string `bson:"script"`
+		Priority int    `bson:"priority"`
+	}
+	err := collection.FindOne(Ctx, bson.M{"regex": regex}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("extractor not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return engine.NewExtractor(result.Regex, result.Script, result.Priority)
+}
+
+func SetExtractorPriority(regex string, priority int) error {
+	engine.L().Infof("setting extractor %s priority: %d", regex, priority)
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	collection := dbClient.Database("mirrorBot").Collection("EXTRACTORS")
+	filter := bson.M{
+		"regex": regex,
+	}
+	res, err := collection.UpdateOne(Ctx, filter, bson.D{{
+		Key: "$set", Value: bson.M{
+			"priority": priority,
+		},
+	}})
+	if err != nil {
+		return err
+	}
+	invalidateExtractorCache()
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("extractor not found")
+	}
+	return nil
+}
+
+// getExtractorTestsCollection : test cases carry recorded responses, kept out of the EXTRACTORS documents so that they do not
+// run into mongo's document size limit
+func getExtractorTestsCollection() *mongo.Collection {
+	return dbClient.Database("mirrorBot").Collection("EXTRACTOR-TESTS")
+}
+
+type extractorTestDocument struct {
+	Regex                 string `bson:"regex"`
+	engine.ScriptTestCase `bson:",inline"`
+}
+
+func AddExtractorTest(regex string, testCase *engine.ScriptTestCase) error {
+	engine.L().Infof("adding extractor test %s : %s", regex, testCase.Name)
+	if _, found := getExtractorScript(regex); !found {
+		return fmt.Errorf("extractor not found")
+	}
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	_, err := getExtractorTestsCollection().InsertOne(Ctx, extractorTestDocument{Regex: regex, ScriptTestCase: *testCase})
+	return err
+}
+
+func deleteExtractorTests(regex string) error {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	_, err := getExtractorTestsCollection().DeleteMany(Ctx, bson.M{"regex": regex})
+	return err
+}
+
+func ClearExtractorTests(regex string) error {
+	engine.L().Infof("clearing extractor tests %s", regex)
+	if _, found := getExtractorScript(regex); !found {
+		return fmt.Errorf("extractor not found")
+	}
+	return deleteExtractorTests(regex)
+}
+
+func GetExtractorTests(regex string) ([]engine.ScriptTestCase, error) {
+	engine.L().Infof("getting extractor tests %s", regex)
+	if _, found := getExtractorScript(regex); !found {
+		return nil, fmt.Errorf("extractor not found")
+	}
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	cur, err := getExtractorTestsCollection().Find(Ctx, bson.M{"regex": regex})
+	if err != nil {
+		return nil, err
+	}
+	var documents []extractorTestDocument
+	err = cur.All(Ctx, &documents)
+	if err != nil {
+		return nil, err
+	}
+	var tests []engine.ScriptTestCase
+	for _, document := range documents {
+		tests = append(tests, document.ScriptTestCase)
+	}
+	return tests, nil
+}
+
+func IsExtractable(link string) bool {
+	extractors, err := GetExtractors()
+	if err != nil {
+		engine.L().Error(err)
+		return false
+	}
+	return len(engine.MatchExtractors(link, extractors)) != 0
+}
+
+// setSecret : values only ever reach mongo encrypted, without a key configured nothing is stored
+func setSecret(key string, value string) error {
+	encrypted, err := utils.EncryptSecret(value)
+	if err != nil {
+		return err
+	}
 	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 	collection := dbClient.Database("mirrorBot").Collection("SCRIPT-SECRETS")
@@ -98,25 +327,49 @@ func UpdateSecret(key string, value string) error {
 	filter := bson.M{
 		"key": key,
 	}
-	_, err := collection.UpdateOne(Ctx, filter, bson.D{{
-		"$set", bson.M{
+	_, err = collection.UpdateOne(Ctx, filter, bson.D{{
+		Key: "$set", Value: bson.M{
 			"key":   key,
-			"value": value,
+			"value": encrypted,
 		},
 	}}, opts)
 	return err
 }
 
-func RemoveSecret(key string) error {
+func UpdateSecret(key string, value string, author *gotgbot.User) error {
+	engine.L().Infof("updating secret %s", key)
+	secrets, err := GetSecrets()
+	if err != nil {
+		return err
+	}
+	err = setSecret(key, value)
+	if err != nil {
+		return err
+	}
+	return recordVersion(VersionKindSecret, key, VersionActionUpdate, secrets[key], value, author)
+}
+
+func RemoveSecret(key string, author *gotgbot.User) error {
 	engine.L().Infof("deleting secret %s", key)
+	secrets, err := GetSecrets()
+	if err != nil {
+		return err
+	}
+	previous, found := secrets[key]
+	if !found {
+		return fmt.Errorf("secret not found")
+	}
 	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 	collection := dbClient.Database("mirrorBot").Collection("SCRIPT-SECRETS")
 	filter := bson.M{
 		"key": key,
 	}
-	_, err := collection.DeleteOne(Ctx, filter)
-	return err
+	_, err = collection.DeleteOne(Ctx, filter)
+	if err != nil {
+		return err
+	}
+	return recordVersion(VersionKindSecret, key, VersionActionRemove, previous, "", author)
 }
 
 func GetSecrets() (map[string]string, error) {
@@ -142,9 +395,85 @@ func GetSecrets() (map[string]string, error) {
 			engine.L().Error(err)
 		} else {
 			if result["key"] != nil && result["value"] != nil {
-				rtr[fmt.Sprint(result["key"])] = fmt.Sprint(result["value"])
+				value, err := utils.DecryptSecret(fmt.Sprint(result["value"]))
+				if err != nil {
+					engine.L().Errorf("getSecrets: skipping %s: %v", result["key"], err)
+					continue
+				}
+				rtr[fmt.Sprint(result["key"])] = value
 			}
 		}
 	}
 	return rtr, nil
 }
+
+// MigrateSecrets : encrypts secrets and secret versions stored in plaintext before encryption at rest existed
+func MigrateSecrets() {
+	if !utils.IsSecretsKeySet() {
+		engine.L().Warnf("%s is not set, extractor secrets can't be added or migrated", utils.SecretsKeyEnv)
+		return
+	}
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	migrated := 0
+	collection := dbClient.Database("mirrorBot").Collection("SCRIPT-SECRETS")
+	cur, err := collection.Find(Ctx, bson.D{})
+	if err != nil {
+		engine.L().Errorf("MigrateSecrets: %v", err)
+		return
+	}
+	var plain []bson.M
+	err = cur.All(Ctx, &plain)
+	if err != nil {
+		engine.L().Errorf("MigrateSecrets: %v", err)
+		return
+	}
+	for _, result := range plain {
+		value, ok := result["value"].(string)
+		if !ok || utils.IsEncryptedSecret(value) {
+			continue
+		}
+		err = setSecret(fmt.Sprint(result["key"]), value)
+		if err != nil {
+			engine.L().Errorf("MigrateSecrets: %s: %v", result["key"], err)
+			continue
+		}
+		migrated++
+	}
+	versions := getVersionsCollection()
+	cur, err = versions.Find(Ctx, bson.M{"kind": VersionKindSecret})
+	if err != nil {
+		engine.L().Errorf("MigrateSecrets: %v", err)
+		return
+	}
+	var history []bson.M
+	err = cur.All(Ctx, &history)
+	if err != nil {
+		engine.L().Errorf("MigrateSecrets: %v", err)
+		return
+	}
+	for _, result := range history {
+		value, ok := result["content"].(string)
+		if !ok || value == "" || utils.IsEncryptedSecret(value) {
+			continue
+		}
+		encrypted, err := utils.EncryptSecret(value)
+		if err != nil {
+			engine.L().Errorf("MigrateSecrets: %v", err)
+			return
+		}
+		_, err = versions.UpdateByID(Ctx, result["_id"], bson.D{{
+			Key: "$set", Value: bson.M{
+				"content": encrypted,
+			},
+		}})
+		if err != nil {
+			engine.L().Errorf("MigrateSecrets: %v", err)
+			continue
+		}
+		migrated++
+	}
+	if migrated != 0 {
+		engine.L().Infof("encrypted %d plaintext secret values", migrated)
+	}
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"MirrorBotGo/engine"
+	"MirrorBotGo/utils"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	VersionKindExtractor = "extractor"
+	VersionKindSecret    = "secret"
+)
+
+const (
+	VersionActionUpdate   = "update"
+	VersionActionRemove   = "remove"
+	VersionActionDisable  = "disable"
+	VersionActionEnable   = "enable"
+	VersionActionRollback = "rollback"
+)
+
+// ScriptVersion : one recorded change of an extractor or a secret, content is the state right after the change
+type ScriptVersion struct {
+	Kind       string    `bson:"kind"`
+	Name       string    `bson:"name"`
+	Version    int       `bson:"version"`
+	Action     string    `bson:"action"`
+	AuthorId   int64     `bson:"authorId"`
+	AuthorName string    `bson:"authorName"`
+	Timestamp  time.Time `bson:"timestamp"`
+	Content    string    `bson:"content"`
+	Diff       string    `bson:"diff"`
+}
+
+func (v *ScriptVersion) Summary() string {
+	return fmt.Sprintf("v%d %s by %s (%d) at %s", v.Version, v.Action, v.AuthorName, v.AuthorId, v.Timestamp.UTC().Format("2006-01-02 15:04:05"))
+}
+
+func getVersionsCollection() *mongo.Collection {
+	return dbClient.Database("mirrorBot").Collection("SCRIPT-VERSIONS")
+}
+
+func getLatestVersionNumber(ctx context.Context, kind string, name string) (int, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	var latest ScriptVersion
+	err := getVersionsCollection().FindOne(ctx, bson.M{"kind": kind, "name": name}, opts).Decode(&latest)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return latest.Version, nil
+}
+
+// recordVersion : secrets never get their values in the diff, only the fact that they changed, and are stored encrypted
+func recordVersion(kind string, name string, action string, previous string, content string, author *gotgbot.User) error {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	latest, err := getLatestVersionNumber(Ctx, kind, name)
+	if err != nil {
+		return err
+	}
+	diff := ""
+	if kind == VersionKindSecret {
+		if previous != content {
+			diff = "value changed"
+		}
+		if content != "" {
+			content, err = utils.EncryptSecret(content)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		diff = utils.LineDiff(previous, content)
+	}
+	version := &ScriptVersion{
+		Kind:      kind,
+		Name:      name,
+		Version:   latest + 1,
+		Action:    action,
+		Timestamp: time.Now(),
+		Content:   content,
+		Diff:      diff,
+	}
+	if author != nil {
+		version.AuthorId = author.Id
+		version.AuthorName = strings.TrimSpace(author.FirstName + " " + author.LastName)
+	}
+	_, err = getVersionsCollection().InsertOne(Ctx, version)
+	if err != nil {
+		engine.L().Errorf("failed to record %s version %s: %v", kind, name, err)
+		return err
+	}
+	engine.L().Infof("recorded %s %s version %d (%s)", kind, name, version.Version, action)
+	return nil
+}
+
+func GetVersions(kind string, name string) ([]*ScriptVersion, error) {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	cur, err := getVersionsCollection().Find(Ctx, bson.M{"kind": kind, "name": name}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer func(cur *mongo.Cursor, ctx context.Context) {
+		err := cur.Close(ctx)
+		if err != nil {
+			engine.L().Errorf("GetVersions: failed to close cursor: %v", err)
+		}
+	}(cur, Ctx)
+	var versions []*ScriptVersion
+	for cur.Next(Ctx) {
+		var version ScriptVersion
+		err := cur.Decode(&version)
+		if err != nil {
+			engine.L().Error(err)
+			continue
+		}
+		versions = append(versions, &version)
+	}
+	return versions, nil
+}
+
+func GetVersion(kind string, name string, number int) (*ScriptVersion, error) {
+	Ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	var version ScriptVersion
+	err := getVersionsCollection().FindOne(Ctx, bson.M{"kind": kind, "name": name, "version": number}).Decode(&version)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("version %d not found", number)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func RollbackExtractor(regex string, number int, author *gotgbot.User) error {
+	version, err := GetVersion(VersionKindExtractor, regex, number)
+	if err != nil {
+		return err
+	}
+	if version.Content == "" {
+		return fmt.Errorf("version %d has no script (%s), pick another one", number, version.Action)
+	}
+	previous, _ := getExtractorScript(regex)
+	err = setExtractorScript(regex, version.Content)
+	if err != nil {
+		return err
+	}
+	return recordVersion(VersionKindExtractor, regex, fmt.Sprintf("%s to v%d", VersionActionRollback, number), previous, version.Content, author)
+}
+
+func RollbackSecret(key string, number int, author *gotgbot.User) error {
+	version, err := GetVersion(VersionKindSecret, key, number)
+	if err != nil {
+		return err
+	}
+	if version.Action == VersionActionRemove {
+		return fmt.Errorf("version %d is a removal, pick another one", number)
+	}
+	value, err := utils.DecryptSecret(version.Content)
+	if err != nil {
+		return err
+	}
+	secrets, err := GetSecrets()
+	if err != nil {
+		return err
+	}
+	err = setSecret(key, value)
+	if err != nil {
+		return err
+	}
+	return recordVersion(VersionKindSecret, key, fmt.Sprintf("%s to v%d", VersionActionRollback, number), secrets[key], value, author)
+}
@@ -0,0 +1,288 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backendCheckTimeout = 10 * time.Second
+
+// backendProbeInterval : /health probes at most this often, in between it answers from the last checks
+const backendProbeInterval = 30 * time.Second
+
+// BackendCheck : returns whatever version information the backend gives out, empty if it has none
+type BackendCheck func(ctx context.Context) (string, error)
+
+// Backend : an external service the bot hands work to, nothing connects at startup, the first use or the supervisor does,
+// so a service that was down when the bot started or restarted since is picked up again
+type Backend struct {
+	Name      string
+	check     BackendCheck
+	onConnect func()
+	enabled   func() bool
+	critical  bool
+	connected bool
+	checked   bool
+	lastErr   error
+	version   string
+	latency   time.Duration
+	since     time.Time
+	lastCheck time.Time
+	mut       sync.Mutex
+	checkMut  sync.Mutex
+}
+
+// BackendHealth : a snapshot of a backend for /health and /health/deps
+type BackendHealth struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	Critical  bool      `json:"critical"`
+	Checked   bool      `json:"checked"`
+	Up        bool      `json:"up"`
+	LatencyMs int64     `json:"latency_ms"`
+	Version   string    `json:"version,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Since     time.Time `json:"since"`
+	LastCheck time.Time `json:"last_check"`
+}
+
+var backends []*Backend
+var backendsMut sync.Mutex
+var backendSupervisorOnce sync.Once
+var lastBackendProbe time.Time
+var backendProbeMut sync.Mutex
+
+// NewBackend : onConnect runs whenever the backend comes up, enabled may be nil for backends that are always used
+func NewBackend(name string, check BackendCheck, onConnect func(), enabled func() bool) *Backend {
+	b := &Backend{Name: name, check: check, onConnect: onConnect, enabled: enabled}
+	backendsMut.Lock()
+	defer backendsMut.Unlock()
+	backends = append(backends, b)
+	return b
+}
+
+// MarkCritical : the bot cannot mirror anything while a critical backend is down, the health check reports degraded
+func (b *Backend) MarkCritical() *Backend {
+	b.critical = true
+	return b
+}
+
+func (b *Backend) IsEnabled() bool {
+	return b.enabled == nil || b.enabled()
+}
+
+func (b *Backend) IsConnected() bool {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return b.connected
+}
+
+// Check : asks the backend now, checks of the same backend do not overlap
+func (b *Backend) Check() error {
+	b.checkMut.Lock()
+	defer b.checkMut.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), backendCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	version, err := b.check(ctx)
+	latency := time.Since(start)
+	b.mut.Lock()
+	wasConnected, wasChecked := b.connected, b.checked
+	b.checked = true
+	b.lastErr = err
+	b.connected = err == nil
+	b.latency = latency
+	b.lastCheck = time.Now()
+	if err == nil {
+		b.version = version
+	}
+	if b.connected != wasConnected || !wasChecked {
+		b.since = time.Now()
+	}
+	b.mut.Unlock()
+	switch {
+	case err == nil && !wasConnected:
+		L().Infof("[backend] %s connected", b.Name)
+		if b.onConnect != nil {
+			b.onConnect()
+		}
+	case err != nil && (wasConnected || !wasChecked):
+		L().Warnf("[backend] %s unreachable: %v", b.Name, err)
+	}
+	return err
+}
+
+// Ensure : a backend that is down is checked again right away instead of waiting for the supervisor
+func (b *Backend) Ensure() error {
+	if b.IsConnected() {
+		return nil
+	}
+	err := b.Check()
+	if err != nil {
+		return fmt.Errorf("%s is unreachable: %v", b.Name, err)
+	}
+	return nil
+}
+
+func (b *Backend) GetHealth() BackendHealth {
+	enabled := b.IsEnabled()
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	health := BackendHealth{
+		Name:      b.Name,
+		Enabled:   enabled,
+		Critical:  b.critical,
+		Checked:   b.checked,
+		Up:        b.connected,
+		LatencyMs: b.latency.Milliseconds(),
+		Version:   b.version,
+		Since:     b.since,
+		LastCheck: b.lastCheck,
+	}
+	if b.lastErr != nil {
+		health.Error = b.lastErr.Error()
+	}
+	return health
+}
+
+func (b *Backend) String() string {
+	if !b.IsEnabled() {
+		return fmt.Sprintf("%s: disabled", b.Name)
+	}
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	if !b.checked {
+		return fmt.Sprintf("%s: not checked yet", b.Name)
+	}
+	since := utils.HumanizeDuration(time.Since(b.since))
+	if b.connected {
+		return fmt.Sprintf("%s: up for %s", b.Name, since)
+	}
+	return fmt.Sprintf("%s: down for %s (%s)", b.Name, since, html.EscapeString(b.lastErr.Error()))
+}
+
+func GetBackends() []*Backend {
+	backendsMut.Lock()
+	defer backendsMut.Unlock()
+	return append([]*Backend(nil), backends...)
+}
+
+func GetBackendsString() string {
+	out := "Backends:\n"
+	for _, b := range GetBackends() {
+		out += b.String() + "\n"
+	}
+	return out
+}
+
+// GetBackendsHealth : the last check of every backend, nothing is probed
+func GetBackendsHealth() []BackendHealth {
+	var out []BackendHealth
+	for _, b := range GetBackends() {
+		out = append(out, b.GetHealth())
+	}
+	return out
+}
+
+// ProbeBackends : checks every enabled backend now, in parallel so that one hanging backend does not hold up the rest,
+// within backendProbeInterval of the last probe the last checks are returned instead
+func ProbeBackends() []BackendHealth {
+	backendProbeMut.Lock()
+	if time.Since(lastBackendProbe) < backendProbeInterval {
+		backendProbeMut.Unlock()
+		return GetBackendsHealth()
+	}
+	lastBackendProbe = time.Now()
+	backendProbeMut.Unlock()
+	all := GetBackends()
+	var wg sync.WaitGroup
+	for _, b := range all {
+		if !b.IsEnabled() {
+			continue
+		}
+		wg.Add(1)
+		go func(b *Backend) {
+			defer wg.Done()
+			b.Check()
+		}(b)
+	}
+	wg.Wait()
+	return GetBackendsHealth()
+}
+
+// GetDegradedBackends : critical backends that were down at their last check, from the supervisor's results
+func GetDegradedBackends() []string {
+	var names []string
+	for _, b := range GetBackends() {
+		health := b.GetHealth()
+		if health.Enabled && health.Critical && health.Checked && !health.Up {
+			names = append(names, health.Name)
+		}
+	}
+	return names
+}
+
+// GetBackendsHealthString : /health, probes every backend unless that was just done
+func GetBackendsHealthString() string {
+	healths := ProbeBackends()
+	degraded := GetDegradedBackends()
+	out := "Health: <code>ok</code>\n\n"
+	if len(degraded) > 0 {
+		out = fmt.Sprintf("Health: <code>degraded</code> (%s)\n\n", html.EscapeString(strings.Join(degraded, ", ")))
+	}
+	for _, health := range healths {
+		out += fmt.Sprintf("<b>%s</b>", html.EscapeString(health.Name))
+		if health.Critical {
+			out += " (critical)"
+		}
+		switch {
+		case !health.Enabled:
+			out += ": disabled\n"
+		case health.Up:
+			out += fmt.Sprintf(": up | %d ms", health.LatencyMs)
+			if health.Version != "" {
+				out += fmt.Sprintf(" | <code>%s</code>", html.EscapeString(health.Version))
+			}
+			out += "\n"
+		default:
+			out += fmt.Sprintf(": down for %s | <code>%s</code>\n", utils.HumanizeDuration(time.Since(health.Since)), html.EscapeString(health.Error))
+		}
+	}
+	return strings.TrimSuffix(out, "\n")
+}
+
+// StartBackendSupervisor : checks every enabled backend in the background right away and then every backend_check_interval
+func StartBackendSupervisor() {
+	backendSupervisorOnce.Do(func() {
+		go func() {
+			for {
+				for _, b := range GetBackends() {
+					if b.IsEnabled() {
+						b.Check()
+					}
+				}
+				time.Sleep(utils.GetBackendCheckInterval())
+			}
+		}()
+	})
+}
+
+// checkHTTPBackend : for services without a status endpoint, any http response means the service is up
+func checkHTTPBackend(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	return res.Header.Get("Server"), nil
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/dop251/goja"
-	"regexp"
 	"strings"
 )
 
@@ -17,48 +16,71 @@ func escapeError(err error) error {
 	return errors.New(strings.ReplaceAll(strings.ReplaceAll(err.Error(), "<", ""), ">", ""))
 }
 
-func extractDDLJS(link string, script string, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (string, error) {
-	r, err := CreateJSRuntime(secrets, b, ctx)
+func extractDDLJS(link string, script string, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (*ExtractResult, error) {
+	return extractDDLJSWithSandbox(link, script, secrets, b, ctx, NewJSSandbox(GetDefaultJSSandboxLimits()))
+}
+
+func extractDDLJSWithSandbox(link string, script string, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context, sandbox *JSSandbox) (*ExtractResult, error) {
+	secrets, err := ScopeSecrets(script, secrets)
+	if err != nil {
+		return nil, err
+	}
+	r, err := CreateJSRuntime(sandbox, secrets, b, ctx)
 	if err != nil {
-		return "", escapeError(err)
+		return nil, escapeError(err)
 	}
+	sandbox.Start(r)
+	defer sandbox.Stop()
 	_, err = r.RunString(script)
 	if err != nil {
-		return "", escapeError(err)
+		return nil, escapeError(sandbox.WrapError(err))
 	}
 	extract, ok := goja.AssertFunction(r.Get("extract"))
 	if !ok {
-		return "", fmt.Errorf("extract function not found in the specified script, please recheck")
+		return nil, fmt.Errorf("extract function not found in the specified script, please recheck")
 	}
 	value, err := extract(goja.Undefined(), r.ToValue(link))
 	if err != nil {
-		return "", escapeError(err)
+		return nil, escapeError(sandbox.WrapError(err))
+	}
+	if err = sandbox.GetLimitErr(); err != nil {
+		return nil, escapeError(err)
+	}
+	if value == nil {
+		return nil, fmt.Errorf("internal error occured, please recheck the script")
 	}
 	if goja.IsNull(value) {
-		return "", fmt.Errorf("javascript returned null")
+		return nil, fmt.Errorf("javascript returned null")
 	}
 	if goja.IsUndefined(value) {
-		return "", fmt.Errorf("javascript returned undefined")
+		return nil, fmt.Errorf("javascript returned undefined")
 	}
 	if goja.IsInfinity(value) {
-		return "", fmt.Errorf("javascript returned infinity")
+		return nil, fmt.Errorf("javascript returned infinity")
 	}
-	if value == nil {
-		return "", fmt.Errorf("internal error occured, please recheck the script")
+	result, err := ParseExtractResult(value)
+	if err != nil {
+		return nil, escapeError(err)
 	}
-	return value.String(), nil
+	return result, nil
 }
 
-func ExtractDDL(link string, extractors map[string]string, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (string, error) {
-	for regex, script := range extractors {
-		matched, err := regexp.MatchString(regex, link)
-		if err != nil {
-			return "", err
-		}
-		if !matched {
+// ExtractDDLResult : runs the first matching extractor in the given order, the result may carry filename, headers and cookies
+func ExtractDDLResult(link string, extractors []*Extractor, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (*ExtractResult, error) {
+	for _, extractor := range extractors {
+		if !extractor.Match(link) {
 			continue
 		}
-		return extractDDLJS(link, script, secrets, b, ctx)
+		L().Infof("extracting %s with %s (priority %d)", link, extractor.Regex, extractor.Priority)
+		return extractDDLJS(link, extractor.Script, secrets, b, ctx)
+	}
+	return nil, fmt.Errorf("no extractor found for this url, do download normally")
+}
+
+func ExtractDDL(link string, extractors []*Extractor, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (string, error) {
+	result, err := ExtractDDLResult(link, extractors, secrets, b, ctx)
+	if err != nil {
+		return "", err
 	}
-	return "", fmt.Errorf("no extractor found for this url, do download normally")
+	return result.Url, nil
 }
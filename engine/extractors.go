@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+)
+
+// Extractor : a stored extractor script with its compiled pattern, higher priority runs first
+type Extractor struct {
+	Regex    string
+	Script   string
+	Priority int
+	Pattern  *regexp.Regexp
+}
+
+func NewExtractor(regex string, script string, priority int) (*Extractor, error) {
+	pattern, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %s: %v", regex, err)
+	}
+	return &Extractor{
+		Regex:    regex,
+		Script:   script,
+		Priority: priority,
+		Pattern:  pattern,
+	}, nil
+}
+
+func (e *Extractor) Match(link string) bool {
+	return e.Pattern.MatchString(link)
+}
+
+// SortExtractors : priority descending, ties broken by the regex so the order never depends on storage
+func SortExtractors(extractors []*Extractor) {
+	sort.SliceStable(extractors, func(i, j int) bool {
+		if extractors[i].Priority != extractors[j].Priority {
+			return extractors[i].Priority > extractors[j].Priority
+		}
+		return extractors[i].Regex < extractors[j].Regex
+	})
+}
+
+// MatchExtractors : every extractor matching the link, in the order they would be tried
+func MatchExtractors(link string, extractors []*Extractor) []*Extractor {
+	var matched []*Extractor
+	for _, extractor := range extractors {
+		if extractor.Match(link) {
+			matched = append(matched, extractor)
+		}
+	}
+	return matched
+}
+
+// ExtractorOverlap : a link matched by more than one extractor, the first one in Matches is the one that runs
+type ExtractorOverlap struct {
+	Link    string
+	Matches []*Extractor
+}
+
+// IsTie : the winner was picked by regex order only because the top priorities are equal
+func (o *ExtractorOverlap) IsTie() bool {
+	return len(o.Matches) > 1 && o.Matches[0].Priority == o.Matches[1].Priority
+}
+
+// FindExtractorOverlaps : regex overlap can't be decided in general, so it is checked against sample links
+func FindExtractorOverlaps(extractors []*Extractor, links []string) []*ExtractorOverlap {
+	var overlaps []*ExtractorOverlap
+	seen := make(map[string]bool)
+	for _, link := range links {
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		matched := MatchExtractors(link, extractors)
+		if len(matched) > 1 {
+			overlaps = append(overlaps, &ExtractorOverlap{Link: link, Matches: matched})
+		}
+	}
+	return overlaps
+}
+
+func GetExtractorOverlapReport(overlaps []*ExtractorOverlap, checked int) string {
+	if len(overlaps) == 0 {
+		return fmt.Sprintf("No overlapping extractors found in %d sample links.", checked)
+	}
+	out := fmt.Sprintf("%d of %d sample links match more than one extractor:\n\n", len(overlaps), checked)
+	for _, overlap := range overlaps {
+		out += fmt.Sprintf("<code>%s</code>\n", html.EscapeString(overlap.Link))
+		for i, extractor := range overlap.Matches {
+			marker := "   "
+			if i == 0 {
+				marker = " ▶ "
+			}
+			out += fmt.Sprintf("%s<code>%s</code> (priority %d)\n", marker, html.EscapeString(extractor.Regex), extractor.Priority)
+		}
+		if overlap.IsTie() {
+			out += "   ⚠️ same priority, picked by regex order\n"
+		}
+		out += "\n"
+	}
+	return out
+}
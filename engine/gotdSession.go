@@ -0,0 +1,420 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/contrib/bg"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/tg"
+)
+
+const gotdLoginTimeout = 30 * time.Second
+
+// GotdSession : a gotd client along with the access hashes it has seen, hashes are only valid for the account that received them
+type GotdSession struct {
+	Name         string
+	Account      string
+	client       *telegram.Client
+	accessHashes map[int64]int64
+	usernames    map[string]int64
+	ready        bool
+	mut          sync.RWMutex
+}
+
+func NewGotdSession(name string, client *telegram.Client) *GotdSession {
+	return &GotdSession{
+		Name:         name,
+		client:       client,
+		accessHashes: make(map[int64]int64),
+		usernames:    make(map[string]int64),
+	}
+}
+
+func (s *GotdSession) API() *tg.Client {
+	return tg.NewClient(s.client)
+}
+
+// SetReady : requests panic until the client runs, so nothing probes a session before it is connected and authorized
+func (s *GotdSession) SetReady() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.ready = true
+}
+
+func (s *GotdSession) IsReady() bool {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.ready
+}
+
+// Check : asks telegram who the session belongs to, which fails both when it is unreachable and when the session was revoked,
+// the account is left out of the version since /health/deps is public
+func (s *GotdSession) Check(ctx context.Context) (string, error) {
+	if !s.IsReady() {
+		return "", errors.New("not connected yet")
+	}
+	_, err := s.client.Self(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("layer %d", tg.Layer), nil
+}
+
+func (s *GotdSession) GetAccessHash(chatID int64) int64 {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	accessHash, ok := s.accessHashes[chatID]
+	if !ok {
+		return -1
+	}
+	return accessHash
+}
+
+func (s *GotdSession) AddAccessHash(chatID int64, accessHash int64) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.accessHashes[chatID] = accessHash
+}
+
+func (s *GotdSession) CacheChats(chats []tg.ChatClass) {
+	for _, chat := range chats {
+		// min constructors carry an access hash that cannot be used for requests
+		if channel, ok := chat.(*tg.Channel); ok && !channel.Min {
+			s.AddAccessHash(channel.ID, channel.AccessHash)
+		}
+	}
+}
+
+// GetChannelByUsername : resolving usernames is heavily rate limited, so resolved ones are remembered
+func (s *GotdSession) GetChannelByUsername(username string) (int64, bool) {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	channelID, ok := s.usernames[strings.ToLower(username)]
+	return channelID, ok
+}
+
+func (s *GotdSession) AddChannelUsername(username string, channelID int64) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.usernames[strings.ToLower(username)] = channelID
+}
+
+// LoadDialogs : users cannot look channels up by id alone, their dialogs are the only source of access hashes
+func (s *GotdSession) LoadDialogs(ctx context.Context) error {
+	return query.GetDialogs(s.API()).BatchSize(100).ForEach(ctx, func(ctx context.Context, elem dialogs.Elem) error {
+		if channel, ok := elem.Peer.(*tg.InputPeerChannel); ok {
+			s.AddAccessHash(channel.ChannelID, channel.AccessHash)
+		}
+		return nil
+	})
+}
+
+// EncryptedSessionStorage : a session.FileStorage whose content is sealed with the secrets key, plaintext files are read once
+// and rewritten encrypted on the next store
+type EncryptedSessionStorage struct {
+	Path string
+	mut  sync.Mutex
+}
+
+func (e *EncryptedSessionStorage) LoadSession(_ context.Context) ([]byte, error) {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	data, err := os.ReadFile(e.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, session.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	decrypted, err := utils.DecryptSecret(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s: %v", e.Path, err)
+	}
+	return []byte(decrypted), nil
+}
+
+func (e *EncryptedSessionStorage) StoreSession(_ context.Context, data []byte) error {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+	encrypted, err := utils.EncryptSecret(string(data))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.Path, []byte(encrypted), 0600)
+}
+
+// gotdLogin : a phone login waiting for its code, and after that maybe for the 2FA password
+type gotdLogin struct {
+	client        *telegram.Client
+	stop          bg.StopFunc
+	phone         string
+	codeHash      string
+	needsPassword bool
+}
+
+// gotdUserSession : nil until the owner logs in or a stored session is restored at startup
+var gotdUserSession *GotdSession
+var gotdUserStop bg.StopFunc
+var gotdUserLogin *gotdLogin
+var gotdUserMut sync.Mutex
+
+func newGotdUserClient() (*telegram.Client, error) {
+	appID, err := strconv.Atoi(utils.GetTgAppId())
+	if err != nil {
+		return nil, err
+	}
+	return telegram.NewClient(appID, utils.GetTgAppHash(), telegram.Options{
+		SessionStorage: &EncryptedSessionStorage{Path: utils.GetTgUserSessionFile()},
+	}), nil
+}
+
+func getGotdAccountString(user *tg.User) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if user.Username != "" {
+		name += " (@" + user.Username + ")"
+	}
+	return fmt.Sprintf("%s [%d]", name, user.ID)
+}
+
+// activateGotdUserSession : callers hold gotdUserMut
+func activateGotdUserSession(client *telegram.Client, stop bg.StopFunc, user tg.UserClass) {
+	userSession := NewGotdSession("user", client)
+	userSession.SetReady()
+	if self, ok := user.AsNotEmpty(); ok {
+		userSession.Account = getGotdAccountString(self)
+	}
+	gotdUserSession = userSession
+	gotdUserStop = stop
+	L().Infof("telegram user session active: %s", userSession.Account)
+}
+
+// RestoreTelegramUserSession : reconnects a session stored by a previous login, if there is one
+func RestoreTelegramUserSession() {
+	if _, err := os.Stat(utils.GetTgUserSessionFile()); err != nil {
+		return
+	}
+	if !utils.IsSecretsKeySet() {
+		L().Warnf("telegram user session found but %s is not set, it cannot be decrypted", utils.SecretsKeyEnv)
+		return
+	}
+	go func() {
+		client, err := newGotdUserClient()
+		if err != nil {
+			L().Errorf("telegram user session: %v", err)
+			return
+		}
+		stop, err := bg.Connect(client)
+		if err != nil {
+			L().Errorf("telegram user session: connect: %v", err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), gotdLoginTimeout)
+		defer cancel()
+		status, err := client.Auth().Status(ctx)
+		if err != nil || !status.Authorized {
+			L().Warnf("stored telegram user session is not authorized anymore, log in again with /tglogin: %v", err)
+			stop()
+			return
+		}
+		gotdUserMut.Lock()
+		defer gotdUserMut.Unlock()
+		activateGotdUserSession(client, stop, status.User)
+	}()
+}
+
+var telegramUserBackend *Backend = NewBackend("Telegram user session", func(ctx context.Context) (string, error) {
+	userSession := GetTelegramUserSession()
+	if userSession == nil {
+		return "", errors.New("logged out")
+	}
+	return userSession.Check(ctx)
+}, nil, func() bool {
+	return GetTelegramUserSession() != nil
+})
+
+func GetTelegramUserSession() *GotdSession {
+	gotdUserMut.Lock()
+	defer gotdUserMut.Unlock()
+	return gotdUserSession
+}
+
+// StartTelegramUserLogin : sends the login code to the account, any unfinished login is dropped,
+// gotdUserMut is only held to swap the login so that GetTelegramUserSession does not wait for telegram
+func StartTelegramUserLogin(phone string) error {
+	if !utils.IsSecretsKeySet() {
+		return fmt.Errorf("set %s first, the user session is stored encrypted with it", utils.SecretsKeyEnv)
+	}
+	gotdUserMut.Lock()
+	if gotdUserSession != nil {
+		account := gotdUserSession.Account
+		gotdUserMut.Unlock()
+		return fmt.Errorf("already logged in as %s, use /tglogout first", account)
+	}
+	previous := gotdUserLogin
+	gotdUserLogin = nil
+	gotdUserMut.Unlock()
+	if previous != nil {
+		previous.stop()
+	}
+	client, err := newGotdUserClient()
+	if err != nil {
+		return err
+	}
+	stop, err := bg.Connect(client)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gotdLoginTimeout)
+	defer cancel()
+	sentCode, err := client.Auth().SendCode(ctx, phone, auth.SendCodeOptions{})
+	if err != nil {
+		stop()
+		return err
+	}
+	gotdUserMut.Lock()
+	if gotdUserSession != nil {
+		gotdUserMut.Unlock()
+		stop()
+		return fmt.Errorf("logged in meanwhile, use /tglogout first")
+	}
+	previous = gotdUserLogin
+	gotdUserLogin = &gotdLogin{client: client, stop: stop, phone: phone, codeHash: sentCode.PhoneCodeHash}
+	gotdUserMut.Unlock()
+	if previous != nil {
+		previous.stop()
+	}
+	return nil
+}
+
+// getPendingGotdLogin : the login in progress, nil if there is none
+func getPendingGotdLogin() (*gotdLogin, bool) {
+	gotdUserMut.Lock()
+	defer gotdUserMut.Unlock()
+	if gotdUserLogin == nil {
+		return nil, false
+	}
+	return gotdUserLogin, gotdUserLogin.needsPassword
+}
+
+// finishGotdLogin : activates the session unless the login was replaced or cancelled while telegram was asked
+func finishGotdLogin(login *gotdLogin, user tg.UserClass) error {
+	gotdUserMut.Lock()
+	defer gotdUserMut.Unlock()
+	if gotdUserLogin != login {
+		return fmt.Errorf("the login was cancelled or restarted meanwhile")
+	}
+	activateGotdUserSession(login.client, login.stop, user)
+	gotdUserLogin = nil
+	return nil
+}
+
+// CompleteTelegramUserLogin : returns true when the account has 2FA and the password is needed next,
+// anything but digits is dropped from the code since telegram expires codes that are sent in a chat as is
+func CompleteTelegramUserLogin(code string) (bool, error) {
+	code = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, code)
+	login, needsPassword := getPendingGotdLogin()
+	if login == nil {
+		return false, fmt.Errorf("no login in progress, start one with /tglogin")
+	}
+	if needsPassword {
+		return true, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gotdLoginTimeout)
+	defer cancel()
+	authorization, err := login.client.Auth().SignIn(ctx, login.phone, code, login.codeHash)
+	if errors.Is(err, auth.ErrPasswordAuthNeeded) {
+		gotdUserMut.Lock()
+		login.needsPassword = true
+		gotdUserMut.Unlock()
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return false, finishGotdLogin(login, authorization.User)
+}
+
+func CompleteTelegramUserPassword(password string) error {
+	login, needsPassword := getPendingGotdLogin()
+	if login == nil || !needsPassword {
+		return fmt.Errorf("no login is waiting for a password")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gotdLoginTimeout)
+	defer cancel()
+	authorization, err := login.client.Auth().Password(ctx, password)
+	if err != nil {
+		return err
+	}
+	return finishGotdLogin(login, authorization.User)
+}
+
+// LogoutTelegramUser : ends the session on telegram's side too and removes the stored session,
+// the session is detached first so that nothing picks it up while telegram is asked
+func LogoutTelegramUser() error {
+	gotdUserMut.Lock()
+	login, session, stop := gotdUserLogin, gotdUserSession, gotdUserStop
+	if login == nil && session == nil {
+		gotdUserMut.Unlock()
+		return fmt.Errorf("no telegram user session")
+	}
+	gotdUserLogin, gotdUserSession, gotdUserStop = nil, nil, nil
+	gotdUserMut.Unlock()
+	if login != nil {
+		login.stop()
+	}
+	if session != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), gotdLoginTimeout)
+		defer cancel()
+		_, err := session.API().AuthLogOut(ctx)
+		if err != nil {
+			L().Warnf("telegram user session: logout: %v", err)
+		}
+		stop()
+	}
+	gotdUserMut.Lock()
+	defer gotdUserMut.Unlock()
+	// the file belongs to a login that was started meanwhile
+	if gotdUserLogin != nil || gotdUserSession != nil {
+		return nil
+	}
+	err := os.Remove(utils.GetTgUserSessionFile())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func GetTelegramSessionsString() string {
+	gotdUserMut.Lock()
+	defer gotdUserMut.Unlock()
+	out := "Bot session: <code>active</code>\n"
+	switch {
+	case gotdUserSession != nil:
+		out += fmt.Sprintf("User session: <code>%s</code>", html.EscapeString(gotdUserSession.Account))
+	case gotdUserLogin != nil && gotdUserLogin.needsPassword:
+		out += "User session: <code>waiting for the 2FA password</code>"
+	case gotdUserLogin != nil:
+		out += "User session: <code>waiting for the login code</code>"
+	default:
+		out += "User session: <code>not logged in</code>"
+	}
+	return out
+}
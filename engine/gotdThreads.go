@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gotdMaxThreads = 16
+	// gotdMinSampleBytes : smaller downloads are over before the threads ramp up and would only add noise
+	gotdMinSampleBytes  = 8 * 1024 * 1024
+	gotdMinSamples      = 3
+	gotdThroughputAlpha = 0.3
+	// gotdExploreEvery : roughly one in this many downloads tries a count next to the fastest one
+	gotdExploreEvery = 10
+)
+
+// gotdPartRequests : part requests in flight across every telegram download
+var gotdPartRequests = make(chan struct{}, utils.GetGotdMaxPartRequests())
+
+func acquireGotdPartRequest(ctx context.Context) error {
+	select {
+	case gotdPartRequests <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func releaseGotdPartRequest() {
+	<-gotdPartRequests
+}
+
+// gotdThroughput : Speed is a moving average in bytes per second so that it follows recent conditions
+type gotdThroughput struct {
+	Samples int
+	Bytes   int64
+	Speed   float64
+}
+
+// gotdSizeBand : files from MinSize up get at most Threads, speeds are only compared within a band
+// because small files never reach the speed of large ones whatever the thread count
+type gotdSizeBand struct {
+	MinSize int64
+	Threads int
+}
+
+var gotdSizeBands = []gotdSizeBand{
+	{MinSize: 0, Threads: 2},
+	{MinSize: 32 * 1024 * 1024, Threads: 4},
+	{MinSize: 256 * 1024 * 1024, Threads: 8},
+	{MinSize: 1024 * 1024 * 1024, Threads: gotdMaxThreads},
+}
+
+type gotdThroughputKey struct {
+	Band    int
+	Threads int
+}
+
+var gotdThroughputStats = make(map[gotdThroughputKey]*gotdThroughput)
+var gotdThroughputMut sync.Mutex
+
+func getGotdSizeBand(size int64) int {
+	band := 0
+	for i, sizeBand := range gotdSizeBands {
+		if size >= sizeBand.MinSize {
+			band = i
+		}
+	}
+	return band
+}
+
+func recordGotdThroughput(threads int, bytes int64, elapsed time.Duration) {
+	if bytes < gotdMinSampleBytes || elapsed <= 0 {
+		return
+	}
+	speed := float64(bytes) / elapsed.Seconds()
+	key := gotdThroughputKey{Band: getGotdSizeBand(bytes), Threads: threads}
+	gotdThroughputMut.Lock()
+	defer gotdThroughputMut.Unlock()
+	stat, ok := gotdThroughputStats[key]
+	if !ok {
+		gotdThroughputStats[key] = &gotdThroughput{Samples: 1, Bytes: bytes, Speed: speed}
+		return
+	}
+	stat.Samples++
+	stat.Bytes += bytes
+	stat.Speed = gotdThroughputAlpha*speed + (1-gotdThroughputAlpha)*stat.Speed
+}
+
+// getGotdSizeThreads : the upper bound for a file, there is no point in more threads than parts
+func getGotdSizeThreads(size int64) int {
+	threads := gotdSizeBands[getGotdSizeBand(size)].Threads
+	parts := int((size + gotdPartSize - 1) / gotdPartSize)
+	if threads > parts {
+		threads = parts
+	}
+	if threads < 1 {
+		threads = 1
+	}
+	return threads
+}
+
+// chooseGotdThreads : a count set with /setgotdthreads wins, otherwise the size bound is used until it has enough samples in
+// the file's size band and after that the count that has been fastest in the band recently, every few downloads half or double
+// of it is tried instead so that counts without samples get some and stale averages are refreshed
+func chooseGotdThreads(size int64) int {
+	if fixed := GetGotdDownloadThreadsCount(); fixed > 0 {
+		return fixed
+	}
+	limit := getGotdSizeThreads(size)
+	band := getGotdSizeBand(size)
+	gotdThroughputMut.Lock()
+	defer gotdThroughputMut.Unlock()
+	stat, ok := gotdThroughputStats[gotdThroughputKey{Band: band, Threads: limit}]
+	if !ok || stat.Samples < gotdMinSamples {
+		return limit
+	}
+	best, bestSpeed := limit, stat.Speed
+	for key, stat := range gotdThroughputStats {
+		if key.Band == band && key.Threads < limit && stat.Samples >= gotdMinSamples && stat.Speed > bestSpeed {
+			best, bestSpeed = key.Threads, stat.Speed
+		}
+	}
+	if rand.Intn(gotdExploreEvery) != 0 {
+		return best
+	}
+	var neighbours []int
+	if best/2 >= 1 {
+		neighbours = append(neighbours, best/2)
+	}
+	if best*2 <= limit {
+		neighbours = append(neighbours, best*2)
+	}
+	if len(neighbours) == 0 {
+		return best
+	}
+	return neighbours[rand.Intn(len(neighbours))]
+}
+
+func GetGotdThreadsString() string {
+	out := ""
+	if fixed := GetGotdDownloadThreadsCount(); fixed > 0 {
+		out += fmt.Sprintf("Threads per download: <code>%d</code>\n", fixed)
+	} else {
+		out += "Threads per download: <code>auto</code>\n"
+	}
+	out += fmt.Sprintf("Part requests: <code>%d/%d</code>\n", len(gotdPartRequests), cap(gotdPartRequests))
+	gotdThroughputMut.Lock()
+	defer gotdThroughputMut.Unlock()
+	if len(gotdThroughputStats) == 0 {
+		out += "No throughput samples yet."
+		return out
+	}
+	var keys []gotdThroughputKey
+	for key := range gotdThroughputStats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Band != keys[j].Band {
+			return keys[i].Band < keys[j].Band
+		}
+		return keys[i].Threads < keys[j].Threads
+	})
+	out += "Throughput by file size and thread count:"
+	for i, key := range keys {
+		if i == 0 || keys[i-1].Band != key.Band {
+			out += fmt.Sprintf("\nFrom %s:\n", utils.GetHumanBytes(gotdSizeBands[key.Band].MinSize))
+		}
+		stat := gotdThroughputStats[key]
+		out += fmt.Sprintf("<code>%2d</code>: %s/s over %d downloads (%s)\n", key.Threads, utils.GetHumanBytes(int64(stat.Speed)), stat.Samples, utils.GetHumanBytes(stat.Bytes))
+	}
+	return strings.TrimSuffix(out, "\n")
+}
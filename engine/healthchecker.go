@@ -1,8 +1,10 @@
 package engine
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func NewHealthRouter() *HealthRouter {
@@ -27,12 +29,49 @@ func (r *HealthRouter) StartWebServer(address string) {
 
 func (r *HealthRouter) registerRoutes() {
 	http.HandleFunc("/health", r.onHealthCheckRequest)
+	http.HandleFunc("/health/deps", r.onHealthDepsRequest)
 	http.HandleFunc("/healthcount", r.onHealthCheckCountRequest)
 }
 
+// onHealthCheckRequest : answers from the supervisor's last checks so that frequent polling does not hit every backend
 func (r *HealthRouter) onHealthCheckRequest(writer http.ResponseWriter, req *http.Request) {
 	r.checked += 1
-	_, err := writer.Write([]byte("ok"))
+	response := "ok"
+	if degraded := GetDegradedBackends(); len(degraded) > 0 {
+		response = "degraded: " + strings.Join(degraded, ", ")
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, err := writer.Write([]byte(response))
+	if err != nil {
+		L().Error(err)
+	}
+}
+
+// onHealthDepsRequest : the supervisor's last checks, the endpoint is unauthenticated so it never probes the backends itself
+// and leaves out the errors, they carry internal urls and hostnames, /health shows them to the owner
+func (r *HealthRouter) onHealthDepsRequest(writer http.ResponseWriter, req *http.Request) {
+	backendHealths := GetBackendsHealth()
+	for i := range backendHealths {
+		backendHealths[i].Error = ""
+	}
+	status := "ok"
+	if len(GetDegradedBackends()) > 0 {
+		status = "degraded"
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"status":   status,
+		"backends": backendHealths,
+	})
+	if err != nil {
+		L().Error(err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if status != "ok" {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, err = writer.Write(data)
 	if err != nil {
 		L().Error(err)
 	}
@@ -4,17 +4,253 @@ import (
 	"MirrorBotGo/utils"
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/jaskaranSM/go-httpdl"
 )
 
+// HTTPRequestOptions : extra data sent with every request of a download, e.g. what an extractor needed to reach the file
+type HTTPRequestOptions struct {
+	Headers     map[string]string
+	Cookies     map[string]string
+	Filename    string
+	UserAgent   string
+	BasicAuth   *url.Userinfo
+	AuthHost    string
+	Proxy       string
+	Connections int
+}
+
+// NewHTTPRequestOptionsFromExtractResult : carries the headers, cookies and suggested filename of an extractor result
+func NewHTTPRequestOptionsFromExtractResult(result *ExtractResult) *HTTPRequestOptions {
+	return &HTTPRequestOptions{
+		Headers:  result.Headers,
+		Cookies:  result.Cookies,
+		Filename: result.Filename,
+	}
+}
+
+// NewHTTPRequestOptionsFromMessage : parses the /mirror options, credentials in the link are moved out of it
+// so the returned link is safe to log and show
+func NewHTTPRequestOptionsFromMessage(link string, options map[string]string) (string, *HTTPRequestOptions, error) {
+	requestOptions := &HTTPRequestOptions{
+		Headers: make(map[string]string),
+		Cookies: make(map[string]string),
+	}
+	u, err := url.Parse(link)
+	if err == nil && u.User != nil && (u.Scheme == "http" || u.Scheme == "https") {
+		requestOptions.BasicAuth = u.User
+		requestOptions.AuthHost = u.Hostname()
+		u.User = nil
+		link = u.String()
+	}
+	if user, ok := options["user"]; ok {
+		name, password, _ := strings.Cut(user, ":")
+		if err != nil {
+			return link, nil, fmt.Errorf("--user needs a valid link: %v", err)
+		}
+		requestOptions.BasicAuth = url.UserPassword(name, password)
+		requestOptions.AuthHost = u.Hostname()
+	}
+	if headers, ok := options["header"]; ok {
+		for _, header := range strings.Split(headers, "\n") {
+			key, value, found := strings.Cut(header, ":")
+			if !found || strings.TrimSpace(key) == "" {
+				return link, nil, fmt.Errorf("invalid header, use --header=\"Name: value\"")
+			}
+			requestOptions.Headers[http.CanonicalHeaderKey(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	if cookies, ok := options["cookie"]; ok {
+		for _, cookie := range strings.FieldsFunc(cookies, func(r rune) bool { return r == ';' || r == '\n' }) {
+			key, value, found := strings.Cut(strings.TrimSpace(cookie), "=")
+			if !found || key == "" {
+				return link, nil, fmt.Errorf("invalid cookie, use --cookie=\"name=value; other=value\"")
+			}
+			requestOptions.Cookies[key] = value
+		}
+	}
+	if ua, ok := options["ua"]; ok {
+		requestOptions.UserAgent = ua
+	}
+	if proxy, ok := options["proxy"]; ok {
+		if proxy != "none" {
+			proxyUrl, err := url.Parse(proxy)
+			if err != nil || (proxyUrl.Scheme != "http" && proxyUrl.Scheme != "https" && proxyUrl.Scheme != "socks5") || proxyUrl.Host == "" {
+				return link, nil, fmt.Errorf("invalid proxy, use --proxy=http://host:port, socks5://host:port or none")
+			}
+		}
+		requestOptions.Proxy = proxy
+	}
+	if connections, ok := options["connections"]; ok {
+		count, err := strconv.Atoi(connections)
+		if err != nil || count < 1 || count > utils.GetHttpMaxConnections() {
+			return link, nil, fmt.Errorf("connections must be between 1 and %d", utils.GetHttpMaxConnections())
+		}
+		requestOptions.Connections = count
+	}
+	return link, requestOptions, nil
+}
+
+// Merge : fields set on o win, used to let /mirror options override what an extractor returned
+func (o *HTTPRequestOptions) Merge(base *HTTPRequestOptions) *HTTPRequestOptions {
+	if base == nil {
+		return o
+	}
+	if o == nil {
+		return base
+	}
+	merged := *base
+	merged.Headers = make(map[string]string)
+	merged.Cookies = make(map[string]string)
+	for _, source := range []*HTTPRequestOptions{base, o} {
+		for k, v := range source.Headers {
+			merged.Headers[k] = v
+		}
+		for k, v := range source.Cookies {
+			merged.Cookies[k] = v
+		}
+	}
+	if o.Filename != "" {
+		merged.Filename = o.Filename
+	}
+	if o.UserAgent != "" {
+		merged.UserAgent = o.UserAgent
+	}
+	if o.BasicAuth != nil {
+		merged.BasicAuth = o.BasicAuth
+		merged.AuthHost = o.AuthHost
+	}
+	if o.Proxy != "" {
+		merged.Proxy = o.Proxy
+	}
+	if o.Connections != 0 {
+		merged.Connections = o.Connections
+	}
+	return &merged
+}
+
+func (o *HTTPRequestOptions) GetConnections() int {
+	if o == nil || o.Connections == 0 {
+		return utils.GetHttpConnections()
+	}
+	return o.Connections
+}
+
+// requestOptionsTransport : go-httpdl builds its own requests, so the options are applied on the way out
+type requestOptionsTransport struct {
+	transport     http.RoundTripper
+	options       *HTTPRequestOptions
+	host          string
+	rangeChecked  bool
+	supportsRange bool
+	mut           sync.Mutex
+}
+
+// recordRangeSupport : the first request without a range is the one go-httpdl decides the connection count with
+func (t *requestOptionsTransport) recordRangeSupport(req *http.Request, res *http.Response) {
+	if req.Header.Get("Range") != "" {
+		return
+	}
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.rangeChecked {
+		return
+	}
+	t.rangeChecked = true
+	t.supportsRange = strings.Contains(res.Header.Get("Accept-Ranges"), "bytes")
+}
+
+func (t *requestOptionsTransport) getRangeSupport() (bool, bool) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.supportsRange, t.rangeChecked
+}
+
+func (t *requestOptionsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	userAgent := t.options.UserAgent
+	if userAgent == "" {
+		userAgent = utils.GetHttpUserAgent()
+	}
+	req.Header.Set("User-Agent", userAgent)
+	// headers and cookies were meant for the host of the link, a redirect to a cdn or anywhere else does not get them
+	if strings.EqualFold(req.URL.Hostname(), t.host) {
+		for k, v := range t.options.Headers {
+			// the range of each part is owned by the downloader
+			if strings.EqualFold(k, "Range") {
+				continue
+			}
+			req.Header.Set(k, v)
+		}
+		for k, v := range t.options.Cookies {
+			req.AddCookie(&http.Cookie{Name: k, Value: v})
+		}
+	}
+	// basic auth is only sent to the host the credentials were given for, the same as headers and cookies
+	if t.options.BasicAuth != nil && strings.EqualFold(req.URL.Hostname(), t.options.AuthHost) {
+		password, _ := t.options.BasicAuth.Password()
+		req.SetBasicAuth(t.options.BasicAuth.Username(), password)
+	}
+	res, err := t.transport.RoundTrip(req)
+	if err == nil {
+		t.recordRangeSupport(req, res)
+	}
+	return res, err
+}
+
+// getProxyFunc : per download proxy, then the configured one, then the environment
+func getProxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	if proxy == "" {
+		proxy = utils.GetHttpProxy()
+	}
+	if proxy == "none" {
+		return nil
+	}
+	if proxy == "" {
+		return http.ProxyFromEnvironment
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil {
+		L().Errorf("invalid http proxy %s: %v", utils.RedactCredentials(proxy), err)
+		return http.ProxyFromEnvironment
+	}
+	return http.ProxyURL(proxyUrl)
+}
+
+// NewHTTPClientWithOptions : link is the url the options were given for
+func NewHTTPClientWithOptions(options *HTTPRequestOptions, link string) *http.Client {
+	if options == nil {
+		options = &HTTPRequestOptions{}
+	}
+	host := ""
+	if u, err := url.Parse(link); err == nil {
+		host = u.Hostname()
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = getProxyFunc(options.Proxy)
+	return &http.Client{
+		Transport: &requestOptionsTransport{
+			transport: transport,
+			options:   options,
+			host:      host,
+		},
+	}
+}
+
 type HTTPDownloadStatus struct {
 	dl          *httpdl.HTTPDownload
+	transport   *requestOptionsTransport
 	listener    *MirrorListener
 	isCancelled bool
 	Index_      int
+	link        string
+	connections int
 }
 
 func (h *HTTPDownloadStatus) Name() string {
@@ -106,10 +342,25 @@ func (h *HTTPDownloadStatus) Index() int {
 	return h.Index_
 }
 
-func NewHTTPDownloadStatus(listener *MirrorListener, dl *httpdl.HTTPDownload) *HTTPDownloadStatus {
+func (h *HTTPDownloadStatus) GetDetails() string {
+	out := "<b>HTTP</b>\n"
+	out += fmt.Sprintf("Connections: <code>%d</code>\n", h.connections)
+	supportsRange, checked := h.transport.getRangeSupport()
+	if !checked {
+		out += "Resumable: <code>unknown</code>"
+		return out
+	}
+	out += fmt.Sprintf("Resumable: <code>%t</code>", supportsRange)
+	return out
+}
+
+func NewHTTPDownloadStatus(listener *MirrorListener, dl *httpdl.HTTPDownload, transport *requestOptionsTransport, link string, connections int) *HTTPDownloadStatus {
 	return &HTTPDownloadStatus{
-		listener: listener,
-		dl:       dl,
+		listener:    listener,
+		dl:          dl,
+		transport:   transport,
+		link:        link,
+		connections: connections,
 	}
 }
 
@@ -140,19 +391,29 @@ func (h *HTTPDownloadListener) OnDownloadComplete(dl *httpdl.HTTPDownload) {
 	h.listener.OnDownloadComplete()
 }
 
-func NewHTTPDownload(link string, listener *MirrorListener) error {
-	httpDownloader := httpdl.NewHTTPDownloader(&http.Client{})
+// NewHTTPDownload : options may be nil for a plain download
+func NewHTTPDownload(link string, listener *MirrorListener, options *HTTPRequestOptions) error {
+	client := NewHTTPClientWithOptions(options, link)
+	httpDownloader := httpdl.NewHTTPDownloader(client)
 	httpListener := NewHTTPDownloadListener(listener)
 	httpDownloader.AddListener(httpListener)
 	dir := path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(listener.GetUid()))
-	dl, err := httpDownloader.AddDownload(link, &httpdl.AddDownloadOpts{
-		Connections: 10,
+	connections := options.GetConnections()
+	filename := ""
+	if options != nil && options.Filename != "" {
+		filename = path.Base(path.Clean("/" + options.Filename))
+	}
+	opts := &httpdl.AddDownloadOpts{
+		Connections: connections,
 		Dir:         dir,
-	})
+		Filename:    filename,
+	}
+	dl, err := httpDownloader.AddDownload(link, opts)
 	if err != nil {
 		return err
 	}
-	status := NewHTTPDownloadStatus(listener, dl)
+	// go-httpdl drops to one connection for servers without range support or size and says so through opts
+	status := NewHTTPDownloadStatus(listener, dl, client.Transport.(*requestOptionsTransport), link, opts.Connections)
 	status.Index_ = GenerateMirrorIndex()
 	AddMirrorLocal(listener.GetUid(), status)
 	return nil
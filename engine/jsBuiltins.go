@@ -0,0 +1,269 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// ExtractResult : what an extractor resolved, scripts may return a bare url string or an object with these fields
+type ExtractResult struct {
+	Url      string            `json:"url"`
+	Filename string            `json:"filename,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+}
+
+// String : the bare url for plain results, compact json otherwise, used to compare script test results
+func (e *ExtractResult) String() string {
+	if e.Filename == "" && len(e.Headers) == 0 && len(e.Cookies) == 0 {
+		return e.Url
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e.Url
+	}
+	return string(data)
+}
+
+func ParseExtractResult(value goja.Value) (*ExtractResult, error) {
+	exported := value.Export()
+	if link, ok := exported.(string); ok {
+		return &ExtractResult{Url: link}, nil
+	}
+	if _, ok := exported.(map[string]interface{}); !ok {
+		return &ExtractResult{Url: value.String()}, nil
+	}
+	data, err := json.Marshal(exported)
+	if err != nil {
+		return nil, err
+	}
+	var result ExtractResult
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result object: %v", err)
+	}
+	if result.Url == "" {
+		return nil, fmt.Errorf("result object has no url")
+	}
+	return &result, nil
+}
+
+func getHashFunc(algo string) (func() hash.Hash, error) {
+	switch strings.ToLower(strings.ReplaceAll(algo, "-", "")) {
+	case "md5":
+		return md5.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm: %s", algo)
+}
+
+// decodeBytes : inputs of the crypto helpers are utf8 unless told to be hex or base64
+func decodeBytes(data string, encoding string) ([]byte, error) {
+	switch strings.ToLower(encoding) {
+	case "", "utf8", "utf-8":
+		return []byte(data), nil
+	case "hex":
+		return hex.DecodeString(data)
+	case "base64":
+		return base64.StdEncoding.DecodeString(data)
+	case "base64url":
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+func Digest(algo string, data string) (string, error) {
+	hashFunc, err := getHashFunc(algo)
+	if err != nil {
+		return "", err
+	}
+	h := hashFunc()
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func HMAC(algo string, key string, data string) (string, error) {
+	hashFunc, err := getHashFunc(algo)
+	if err != nil {
+		return "", err
+	}
+	h := hmac.New(hashFunc, []byte(key))
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type AESDecryptOptions struct {
+	Mode         string `json:"mode"`
+	Key          string `json:"key"`
+	KeyEncoding  string `json:"keyEncoding"`
+	IV           string `json:"iv"`
+	IVEncoding   string `json:"ivEncoding"`
+	Data         string `json:"data"`
+	DataEncoding string `json:"dataEncoding"`
+}
+
+func pkcs7Unpad(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty plaintext")
+	}
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(data) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	if !bytes.Equal(data[len(data)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return data[:len(data)-padding], nil
+}
+
+// AESDecrypt : cbc and ecb are pkcs7 unpadded, ctr and gcm are not padded, data defaults to base64
+func AESDecrypt(options *AESDecryptOptions) (string, error) {
+	if options.DataEncoding == "" {
+		options.DataEncoding = "base64"
+	}
+	key, err := decodeBytes(options.Key, options.KeyEncoding)
+	if err != nil {
+		return "", fmt.Errorf("key: %v", err)
+	}
+	iv, err := decodeBytes(options.IV, options.IVEncoding)
+	if err != nil {
+		return "", fmt.Errorf("iv: %v", err)
+	}
+	data, err := decodeBytes(options.Data, options.DataEncoding)
+	if err != nil {
+		return "", fmt.Errorf("data: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	var plain []byte
+	switch strings.ToLower(options.Mode) {
+	case "", "cbc":
+		if len(iv) != aes.BlockSize || len(data)%aes.BlockSize != 0 {
+			return "", fmt.Errorf("invalid iv or data length for cbc")
+		}
+		plain = make([]byte, len(data))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+		plain, err = pkcs7Unpad(plain)
+	case "ecb":
+		if len(data)%aes.BlockSize != 0 {
+			return "", fmt.Errorf("invalid data length for ecb")
+		}
+		plain = make([]byte, len(data))
+		for i := 0; i < len(data); i += aes.BlockSize {
+			block.Decrypt(plain[i:i+aes.BlockSize], data[i:i+aes.BlockSize])
+		}
+		plain, err = pkcs7Unpad(plain)
+	case "ctr":
+		if len(iv) != aes.BlockSize {
+			return "", fmt.Errorf("invalid iv length for ctr")
+		}
+		plain = make([]byte, len(data))
+		cipher.NewCTR(block, iv).XORKeyStream(plain, data)
+	case "gcm":
+		gcm, gcmErr := cipher.NewGCMWithNonceSize(block, len(iv))
+		if gcmErr != nil {
+			return "", gcmErr
+		}
+		plain, err = gcm.Open(nil, iv, data, nil)
+	default:
+		return "", fmt.Errorf("unsupported aes mode: %s", options.Mode)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func HookUpBuiltins(r *goja.Runtime, sandbox *JSSandbox) (*goja.Runtime, error) {
+	builtins := map[string]interface{}{
+		"digest_go": Digest,
+		"hmac_go":   HMAC,
+		"aesDecrypt_go": func(params string) (string, error) {
+			options := &AESDecryptOptions{}
+			err := json.Unmarshal([]byte(params), options)
+			if err != nil {
+				return "", err
+			}
+			return AESDecrypt(options)
+		},
+		"encodeForm_go": func(params string) (string, error) {
+			form := make(map[string]string)
+			err := json.Unmarshal([]byte(params), &form)
+			if err != nil {
+				return "", err
+			}
+			values := url.Values{}
+			for k, v := range form {
+				values.Set(k, v)
+			}
+			return values.Encode(), nil
+		},
+		"sleep_go": func(ms int64) error {
+			return sandbox.Sleep(time.Duration(ms) * time.Millisecond)
+		},
+		"getCookies_go": func(link string) (string, error) {
+			cookies, err := sandbox.GetCookies(link)
+			if err != nil {
+				return "", err
+			}
+			data, err := json.Marshal(cookies)
+			return string(data), err
+		},
+		"setCookie_go": sandbox.SetCookie,
+	}
+	for name, fn := range builtins {
+		err := r.Set(name, fn)
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// JSBuiltinDefinitions : js side of the builtins, objects cross the boundary as json
+const JSBuiltinDefinitions = `
+function digest(algo, data) { return digest_go(algo, data) }
+function hmac(algo, key, data) { return hmac_go(algo, key, data) }
+function aesDecrypt(options) { return aesDecrypt_go(JSON.stringify(options)) }
+function encodeForm(obj) {
+	var form = {}
+	Object.keys(obj).forEach(function (k) { form[k] = String(obj[k]) })
+	return encodeForm_go(JSON.stringify(form))
+}
+function sleep(ms) { sleep_go(ms) }
+function getCookies(url) { return JSON.parse(getCookies_go(url)) }
+function setCookie(url, name, value) { setCookie_go(url, name, String(value)) }
+function jsonPath(obj, path) {
+	if (typeof obj === "string") obj = JSON.parse(obj)
+	var parts = path.replace(/\[(\w+)\]/g, ".$1").replace(/^\$?\.?/, "").split(".")
+	for (var i = 0; i < parts.length; i++) {
+		if (parts[i] === "") continue
+		if (obj === null || obj === undefined) return undefined
+		obj = obj[parts[i]]
+	}
+	return obj
+}
+`
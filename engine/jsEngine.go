@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -11,40 +12,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"sync"
 )
 
-type Jar struct {
-	lk      sync.Mutex
-	cookies map[string][]*http.Cookie
-}
-
-func NewJar() *Jar {
-	jar := new(Jar)
-	jar.cookies = make(map[string][]*http.Cookie)
-	return jar
-}
-
-// SetCookies handles the receipt of the cookies in a reply for the
-// given URL.  It may or may not choose to save the cookies, depending
-// on the jar's policy and implementation.
-func (jar *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
-	jar.lk.Lock()
-	jar.cookies[u.Host] = cookies
-	jar.lk.Unlock()
-}
-
-// Cookies returns the cookies to send in a request for the given URL.
-// It is up to the implementation to honor the standard cookie use
-// restrictions such as in RFC 6265.
-func (jar *Jar) Cookies(u *url.URL) []*http.Cookie {
-	return jar.cookies[u.Host]
-}
-
-var jar = NewJar()
-
 type Response struct {
+	Status   int               `json:"status"`
+	Url      string            `json:"url"`
 	Headers  map[string]string `json:"headers"`
+	Cookies  map[string]string `json:"cookies"`
 	BodyText string            `json:"bodyText"`
 }
 
@@ -53,18 +27,40 @@ func (r *Response) Marshal() ([]byte, error) {
 }
 
 type RequestOptions struct {
-	Method  string            `json:"method"`
-	Url     string            `json:"url"`
-	Body    string            `json:"body"`
-	Headers map[string]string `json:"headers"`
-	Cookies map[string]string `json:"cookies"`
+	Method          string            `json:"method"`
+	Url             string            `json:"url"`
+	Body            string            `json:"body"`
+	Form            map[string]string `json:"form"`
+	JSON            interface{}       `json:"json"`
+	Headers         map[string]string `json:"headers"`
+	Cookies         map[string]string `json:"cookies"`
+	FollowRedirects *bool             `json:"followRedirects"`
+}
+
+// getBody : form and json options take precedence over the raw body and set the content type when missing
+func (r *RequestOptions) getBody() (string, string, error) {
+	if r.Form != nil {
+		values := url.Values{}
+		for k, v := range r.Form {
+			values.Set(k, v)
+		}
+		return values.Encode(), "application/x-www-form-urlencoded", nil
+	}
+	if r.JSON != nil {
+		data, err := json.Marshal(r.JSON)
+		if err != nil {
+			return "", "", err
+		}
+		return string(data), "application/json", nil
+	}
+	return r.Body, "", nil
 }
 
 func (r *RequestOptions) Unmarshal(data string) error {
 	return json.Unmarshal([]byte(data), r)
 }
 
-func RequestWithRuntime(r *goja.Runtime) func(this goja.Value, args ...goja.Value) (goja.Value, error) {
+func RequestWithRuntime(r *goja.Runtime, sandbox *JSSandbox) func(this goja.Value, args ...goja.Value) (goja.Value, error) {
 	return func(this goja.Value, args ...goja.Value) (goja.Value, error) {
 		params := this.String()
 		options := &RequestOptions{}
@@ -72,14 +68,26 @@ func RequestWithRuntime(r *goja.Runtime) func(this goja.Value, args ...goja.Valu
 		if err != nil {
 			return nil, err
 		}
-		var reader io.Reader = nil
-		if options.Method == "POST" {
-			reader = bytes.NewReader([]byte(options.Body))
+		if options.Method == "" {
+			options.Method = http.MethodGet
 		}
-		req, err := http.NewRequest(options.Method, options.Url, reader)
+		body, contentType := "", ""
+		if options.Method != http.MethodGet && options.Method != http.MethodHead {
+			body, contentType, err = options.getBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		req, err := sandbox.NewRequest(options.Method, options.Url, body)
 		if err != nil {
 			return nil, err
 		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if options.FollowRedirects != nil && !*options.FollowRedirects {
+			req = req.WithContext(context.WithValue(req.Context(), noRedirectKey{}, true))
+		}
 		if len(options.Headers) > 0 {
 			for k, v := range options.Headers {
 				req.Header.Set(k, v)
@@ -93,10 +101,7 @@ func RequestWithRuntime(r *goja.Runtime) func(this goja.Value, args ...goja.Valu
 				})
 			}
 		}
-		client := http.Client{
-			Jar: jar,
-		}
-		res, err := client.Do(req)
+		res, err := sandbox.Do(req)
 		if err != nil {
 			return nil, err
 		}
@@ -112,13 +117,20 @@ func RequestWithRuntime(r *goja.Runtime) func(this goja.Value, args ...goja.Valu
 				headers[key] = value[0]
 			}
 		}
-		body, err := io.ReadAll(io.LimitReader(res.Body, 50*1024*1024))
+		resBody, err := sandbox.ReadBody(res)
 		if err != nil {
 			return nil, err
 		}
+		cookies := make(map[string]string)
+		for _, cookie := range res.Cookies() {
+			cookies[cookie.Name] = cookie.Value
+		}
 		response := &Response{
+			Status:   res.StatusCode,
+			Url:      res.Request.URL.String(),
 			Headers:  headers,
-			BodyText: string(body),
+			Cookies:  cookies,
+			BodyText: string(resBody),
 		}
 		responseJSON, err := response.Marshal()
 		if err != nil {
@@ -178,8 +190,8 @@ func LogWithBot(r *goja.Runtime, b *gotgbot.Bot, ctx *ext.Context) func(this goj
 	}
 }
 
-func HookUpHTTPRequesting(r *goja.Runtime) (*goja.Runtime, error) {
-	err := r.Set("request_go", RequestWithRuntime(r))
+func HookUpHTTPRequesting(r *goja.Runtime, sandbox *JSSandbox) (*goja.Runtime, error) {
+	err := r.Set("request_go", RequestWithRuntime(r, sandbox))
 	return r, err
 }
 
@@ -212,9 +224,9 @@ function cleanFilename(e){return[/\$/g,/\&/g,/\^/g,/\?/g,/\</g,/\>/g,/\:/g,/\!/g
 	return JSDefinitions
 }
 
-func CreateJSRuntime(secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (*goja.Runtime, error) {
+func CreateJSRuntime(sandbox *JSSandbox, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (*goja.Runtime, error) {
 	r := goja.New()
-	_, err := HookUpHTTPRequesting(r)
+	_, err := HookUpHTTPRequesting(r, sandbox)
 	if err != nil {
 		return r, err
 	}
@@ -226,7 +238,11 @@ func CreateJSRuntime(secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context
 	if err != nil {
 		return r, err
 	}
-	_, err = r.RunString(JSDefinitions)
+	_, err = HookUpBuiltins(r, sandbox)
+	if err != nil {
+		return r, err
+	}
+	_, err = r.RunString(JSDefinitions + JSBuiltinDefinitions)
 	if err != nil {
 		return r, err
 	}
@@ -0,0 +1,344 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+const JSMaxRedirects = 10
+
+// jsMemoryCheckInterval : how often the heap is sampled while a script runs, reading it does not stop the world
+const jsMemoryCheckInterval = 50 * time.Millisecond
+
+const jsHeapMetric = "/memory/classes/heap/objects:bytes"
+
+// noRedirectKey : context key set by request_go when the script asked for followRedirects: false
+type noRedirectKey struct{}
+
+// JSLimitError : returned when an extractor script hits one of the sandbox limits
+type JSLimitError struct {
+	Limit  string
+	Detail string
+}
+
+func (e *JSLimitError) Error() string {
+	return fmt.Sprintf("script limit exceeded (%s): %s", e.Limit, e.Detail)
+}
+
+type JSSandboxLimits struct {
+	Timeout            time.Duration
+	MaxRequests        int
+	MaxResponseSize    int64
+	MaxRequestBodySize int64
+	AllowedHosts       []string
+	DeniedHosts        []string
+	AllowPrivateHosts  bool
+	SleepBudget        time.Duration
+	MaxMemory          int64
+}
+
+func GetDefaultJSSandboxLimits() *JSSandboxLimits {
+	return &JSSandboxLimits{
+		Timeout:            utils.GetJSTimeout(),
+		MaxRequests:        utils.GetJSMaxRequests(),
+		MaxResponseSize:    utils.GetJSMaxResponseSize(),
+		MaxRequestBodySize: utils.GetJSMaxRequestBodySize(),
+		AllowedHosts:       utils.GetJSAllowedHosts(),
+		DeniedHosts:        utils.GetJSDeniedHosts(),
+		AllowPrivateHosts:  utils.GetJSAllowPrivateHosts(),
+		SleepBudget:        utils.GetJSSleepBudget(),
+		MaxMemory:          utils.GetJSMaxMemory(),
+	}
+}
+
+// JSSandbox : limits of a single script run, every request_go call of the run goes through it
+type JSSandbox struct {
+	limits       *JSSandboxLimits
+	client       *http.Client
+	jar          *cookiejar.Jar
+	ctx          context.Context
+	cancel       context.CancelFunc
+	timer        *time.Timer
+	requestCount int
+	slept        time.Duration
+	limitErr     error
+	mut          sync.Mutex
+}
+
+func NewJSSandbox(limits *JSSandboxLimits) *JSSandbox {
+	s := &JSSandbox{limits: limits}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	// every run gets its own jar so cookies never leak between scripts
+	s.jar, _ = cookiejar.New(nil)
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: s.checkDialAddress,
+	}
+	s.client = &http.Client{
+		Jar: s.jar,
+		// no proxy, through one the dial time check would only ever see the proxy's address
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if req.Context().Value(noRedirectKey{}) != nil {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= JSMaxRedirects {
+				return s.setLimitErr(&JSLimitError{Limit: "redirects", Detail: fmt.Sprintf("stopped after %d redirects", len(via))})
+			}
+			return s.checkRequest(req)
+		},
+	}
+	return s
+}
+
+// SetTransport : swaps the network transport, used by the script test harness to replay or record requests
+func (s *JSSandbox) SetTransport(transport http.RoundTripper) {
+	s.client.Transport = transport
+}
+
+func (s *JSSandbox) GetTransport() http.RoundTripper {
+	return s.client.Transport
+}
+
+// Start : arms the execution deadline and the memory ceiling, the runtime is interrupted once either is passed
+func (s *JSSandbox) Start(r *goja.Runtime) {
+	if s.limits.MaxMemory > 0 {
+		go s.watchMemory(r)
+	}
+	if s.limits.Timeout <= 0 {
+		return
+	}
+	s.timer = time.AfterFunc(s.limits.Timeout, func() {
+		err := s.setLimitErr(&JSLimitError{Limit: "timeout", Detail: fmt.Sprintf("script did not finish within %s", s.limits.Timeout)})
+		s.cancel()
+		r.Interrupt(err)
+	})
+}
+
+func readHeapBytes() int64 {
+	sample := []metrics.Sample{{Name: jsHeapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return int64(sample[0].Value.Uint64())
+}
+
+// watchMemory : goja cannot account memory per runtime, so the growth of the whole heap since the run started is what is
+// limited, which is why js_max_memory is off unless set, other work allocating at the same time counts against it
+func (s *JSSandbox) watchMemory(r *goja.Runtime) {
+	baseline := readHeapBytes()
+	ticker := time.NewTicker(jsMemoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		grown := readHeapBytes() - baseline
+		if grown > s.limits.MaxMemory {
+			err := s.setLimitErr(&JSLimitError{Limit: "memory", Detail: fmt.Sprintf("heap grew by %s, above %s", utils.GetHumanBytes(grown), utils.GetHumanBytes(s.limits.MaxMemory))})
+			s.cancel()
+			r.Interrupt(err)
+			return
+		}
+	}
+}
+
+func (s *JSSandbox) Stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.cancel()
+}
+
+// setLimitErr : remembers the first limit hit, scripts may swallow the thrown error but the run still fails with it
+func (s *JSSandbox) setLimitErr(err *JSLimitError) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.limitErr == nil {
+		s.limitErr = err
+	}
+	return err
+}
+
+func (s *JSSandbox) GetLimitErr() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.limitErr
+}
+
+// WrapError : prefers the limit error over the generic error produced by goja
+func (s *JSSandbox) WrapError(err error) error {
+	if limitErr := s.GetLimitErr(); limitErr != nil {
+		return limitErr
+	}
+	var interrupted *goja.InterruptedError
+	if errors.As(err, &interrupted) {
+		return fmt.Errorf("script interrupted: %v", interrupted.Value())
+	}
+	return err
+}
+
+func hostMatches(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "*."))
+		if host == pattern || strings.HasSuffix(host, "."+pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	// carrier grade nat, 100.64.0.0/10
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xc0 == 64 {
+		return true
+	}
+	return false
+}
+
+// CheckURL : scheme and host allow/deny list check, private addresses are checked again at dial time
+func (s *JSSandbox) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return s.setLimitErr(&JSLimitError{Limit: "scheme", Detail: fmt.Sprintf("scheme %q is not allowed", u.Scheme)})
+	}
+	host := u.Hostname()
+	if hostMatches(host, s.limits.DeniedHosts) {
+		return s.setLimitErr(&JSLimitError{Limit: "host", Detail: fmt.Sprintf("host %s is denied", host)})
+	}
+	if len(s.limits.AllowedHosts) != 0 && !hostMatches(host, s.limits.AllowedHosts) {
+		return s.setLimitErr(&JSLimitError{Limit: "host", Detail: fmt.Sprintf("host %s is not in the allow list", host)})
+	}
+	if !s.limits.AllowPrivateHosts {
+		if strings.ToLower(host) == "localhost" || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+			return s.setLimitErr(&JSLimitError{Limit: "host", Detail: fmt.Sprintf("host %s is private", host)})
+		}
+		if ip := net.ParseIP(host); ip != nil && isPrivateIP(ip) {
+			return s.setLimitErr(&JSLimitError{Limit: "host", Detail: fmt.Sprintf("address %s is private", host)})
+		}
+	}
+	return nil
+}
+
+// checkDialAddress : catches hostnames resolving to private addresses, including after redirects
+func (s *JSSandbox) checkDialAddress(network string, address string, _ syscall.RawConn) error {
+	if s.limits.AllowPrivateHosts {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && isPrivateIP(ip) {
+		return s.setLimitErr(&JSLimitError{Limit: "host", Detail: fmt.Sprintf("address %s is private", host)})
+	}
+	return nil
+}
+
+func (s *JSSandbox) checkRequest(req *http.Request) error {
+	s.mut.Lock()
+	s.requestCount++
+	count := s.requestCount
+	s.mut.Unlock()
+	if count > s.limits.MaxRequests {
+		return s.setLimitErr(&JSLimitError{Limit: "requests", Detail: fmt.Sprintf("more than %d requests", s.limits.MaxRequests)})
+	}
+	return s.CheckURL(req.URL)
+}
+
+func (s *JSSandbox) NewRequest(method string, link string, body string) (*http.Request, error) {
+	if int64(len(body)) > s.limits.MaxRequestBodySize {
+		return nil, s.setLimitErr(&JSLimitError{Limit: "request size", Detail: fmt.Sprintf("request body of %s is above %s", utils.GetHumanBytes(int64(len(body))), utils.GetHumanBytes(s.limits.MaxRequestBodySize))})
+	}
+	var reader io.Reader = nil
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	return http.NewRequestWithContext(s.ctx, method, link, reader)
+}
+
+func (s *JSSandbox) Do(req *http.Request) (*http.Response, error) {
+	err := s.checkRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+// ReadBody : reads the response body, failing instead of truncating when it is above the size limit
+func (s *JSSandbox) ReadBody(res *http.Response) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(res.Body, s.limits.MaxResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > s.limits.MaxResponseSize {
+		return nil, s.setLimitErr(&JSLimitError{Limit: "response size", Detail: fmt.Sprintf("response from %s is above %s", res.Request.URL.Host, utils.GetHumanBytes(s.limits.MaxResponseSize))})
+	}
+	return body, nil
+}
+
+// Sleep : pauses the script, bounded by the sleep budget and aborted by the execution deadline
+func (s *JSSandbox) Sleep(duration time.Duration) error {
+	// a negative sleep would otherwise hand budget back
+	if duration < 0 {
+		return s.setLimitErr(&JSLimitError{Limit: "sleep", Detail: fmt.Sprintf("cannot sleep for a negative duration (%s)", duration)})
+	}
+	s.mut.Lock()
+	if duration > s.limits.SleepBudget-s.slept {
+		s.mut.Unlock()
+		return s.setLimitErr(&JSLimitError{Limit: "sleep", Detail: fmt.Sprintf("sleeping %s more would exceed the budget of %s", duration, s.limits.SleepBudget)})
+	}
+	s.slept += duration
+	s.mut.Unlock()
+	select {
+	case <-time.After(duration):
+		return nil
+	case <-s.ctx.Done():
+		return fmt.Errorf("sleep aborted")
+	}
+}
+
+func (s *JSSandbox) GetCookies(link string) (map[string]string, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	cookies := make(map[string]string)
+	for _, cookie := range s.jar.Cookies(u) {
+		cookies[cookie.Name] = cookie.Value
+	}
+	return cookies, nil
+}
+
+func (s *JSSandbox) SetCookie(link string, name string, value string) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	s.jar.SetCookies(u, []*http.Cookie{{Name: name, Value: value}})
+	return nil
+}
@@ -3,11 +3,13 @@ package engine
 import (
 	"MirrorBotGo/utils"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/liut/kedge-go"
+	"html"
 	"io"
 	"net/http"
 	"os"
@@ -27,6 +29,9 @@ const (
 	CheckingResumeData  = 7
 )
 
+// kedgeSeedingMaxFailures : a minute of failed status requests while seeding
+const kedgeSeedingMaxFailures = 12
+
 type TorrentStatus struct {
 	AddedTime             int64   `json:"added_time"`
 	State                 int     `json:"state"`
@@ -97,6 +102,7 @@ func (t *TorrentStatus) Unmarshal(data []byte) error {
 
 type TorrentProps struct {
 	IsMagnet bool
+	Link     string
 	Spec     *torrent.TorrentSpec
 	Meta     *metainfo.MetaInfo
 }
@@ -128,19 +134,79 @@ type KedgeDownloadListener struct {
 	SeedingSpeed      int64
 	CompletedTime     time.Time
 	UploadedBytes     int64
-	SeedStartTime     time.Time
+	lastTotalWanted   int64
+	IsWatcherRunning  bool
 }
 
 func (k *KedgeDownloadListener) OnSeedingStart() {
 	L().Infof("[kedge]: OnSeedingStart: %s", k.props.Spec.InfoHash.HexString())
-	k.SeedStartTime = time.Now()
 	k.listener.OnSeedingStart(k.listener.GetDownload().Gid())
+	k.StartSeedingWatcher()
+}
+
+// GetRatio : all time uploaded bytes over the wanted size, as last seen by the seeding watcher
+func (k *KedgeDownloadListener) GetRatio(totalWanted int64) float64 {
+	if totalWanted == 0 {
+		return 0
+	}
+	return float64(k.UploadedBytes) / float64(totalWanted)
+}
+
+func (k *KedgeDownloadListener) StartSeedingWatcher() {
+	k.IsWatcherRunning = true
+	go k.WatchSeeding()
+}
+
+func (k *KedgeDownloadListener) StopSeedingWatcher() {
+	k.IsWatcherRunning = false
+}
+
+// WatchSeeding : tracks upload stats of the seeding torrent and drops it once the seed policy is satisfied
+func (k *KedgeDownloadListener) WatchSeeding() {
+	policy := k.listener.GetSeedPolicy()
+	L().Infof("[kedge]: seed policy for %s: %s", k.props.Spec.InfoHash.HexString(), policy.String())
+	failures := 0
+	for k.IsWatcherRunning {
+		stats, err := k.statusGetter(k.props.Spec.InfoHash.HexString())
+		if err != nil {
+			failures++
+			L().Errorf("[kedge]: WatchSeeding (%d/%d): %v", failures, kedgeSeedingMaxFailures, err)
+			// the torrent was removed from kedge or kedge is gone for good
+			if failures >= kedgeSeedingMaxFailures {
+				k.OnSeedingError(fmt.Errorf("kedge stopped reporting the torrent: %v", err), k.GetRatio(k.lastTotalWanted))
+				break
+			}
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		failures = 0
+		k.UploadedBytes = stats.AllTimeUpload
+		k.SeedingSpeed = stats.UploadRate
+		k.lastTotalWanted = stats.TotalWanted
+		// never remove files which are still being uploaded
+		if k.listener.IsUploadDone() && policy.IsReached(k.GetRatio(stats.TotalWanted), k.listener.GetSeedTime()) {
+			k.OnSeedingComplete(stats)
+			break
+		}
+		time.Sleep(5 * time.Second)
+	}
 }
 
-func (k *KedgeDownloadListener) OnSeedingError(ratio float32) {
+func (k *KedgeDownloadListener) OnSeedingComplete(stats *TorrentStatus) {
+	k.StopSeedingWatcher()
+	k.cacheLastStats()
+	err := k.stopTorrent(k.props.Spec.InfoHash.HexString())
+	if err != nil {
+		L().Errorf("kedge error while stopping torrent in seeding complete: %v", err)
+	}
+	text := fmt.Sprintf("Ratio: %.2f, SeedTime: %s", k.GetRatio(stats.TotalWanted), utils.HumanizeDuration(k.listener.GetSeedTime()))
+	k.listener.OnSeedingComplete(text)
+}
+
+func (k *KedgeDownloadListener) OnSeedingError(err error, ratio float64) {
 	k.StopListener()
-	seedTime := time.Now().Sub(k.CompletedTime)
-	text := fmt.Sprintf("Cancelled by user. Ratio: %.2f, SeedTime: %s", ratio, utils.HumanizeDuration(seedTime))
+	k.StopSeedingWatcher()
+	text := fmt.Sprintf("%s. Ratio: %.2f, SeedTime: %s", err.Error(), ratio, utils.HumanizeDuration(k.listener.GetSeedTime()))
 	k.listener.OnSeedingError(fmt.Errorf(text))
 }
 
@@ -283,11 +349,23 @@ func (k *KedgeDownloader) PauseTorrent(hash string) error {
 }
 
 func (k *KedgeDownloader) GetTorrentSpec(link string) (*TorrentProps, error) {
+	return GetTorrentProps(link)
+}
+
+// GetTorrentProps : parses the magnet or fetches the .torrent, injecting the tracker list when enabled
+func GetTorrentProps(link string) (*TorrentProps, error) {
 	var spec *torrent.TorrentSpec
 	var err error
-	var props *TorrentProps = &TorrentProps{IsMagnet: utils.IsMagnetLink(link)}
+	var props *TorrentProps = &TorrentProps{IsMagnet: utils.IsMagnetLink(link), Link: link}
+	var trackers []string
+	if utils.GetTorrentUseTrackerList() {
+		trackers = GetTrackerListCache().GetTrackers()
+	}
 	if props.IsMagnet {
-		spec, err = torrent.TorrentSpecFromMagnetUri(link)
+		if len(trackers) != 0 {
+			props.Link = InjectTrackersIntoMagnet(link, trackers)
+		}
+		spec, err = torrent.TorrentSpecFromMagnetUri(props.Link)
 		if err != nil {
 			return props, err
 		}
@@ -300,13 +378,16 @@ func (k *KedgeDownloader) GetTorrentSpec(link string) (*TorrentProps, error) {
 		defer func(reader io.ReadCloser) {
 			err := reader.Close()
 			if err != nil {
-				L().Errorf("GetTorrentSpec: reader.Close(): %s : %v", link, err)
+				L().Errorf("GetTorrentProps: reader.Close(): %s : %v", link, err)
 			}
 		}(reader)
 		meta, err := metainfo.Load(reader)
 		if err != nil {
 			return props, err
 		}
+		if len(trackers) != 0 {
+			InjectTrackersIntoMetaInfo(meta, trackers)
+		}
 		props.Meta = meta
 		spec, err = torrent.TorrentSpecFromMetaInfoErr(meta)
 		if err != nil {
@@ -359,7 +440,7 @@ func (k *KedgeDownloader) PrepDownload(gid string, link string, dir string, list
 		return
 	}
 	if props.IsMagnet {
-		err = k.AddTorrent(strings.NewReader(link), dir, true)
+		err = k.AddTorrent(strings.NewReader(props.Link), dir, true)
 	} else {
 		var buffer bytes.Buffer
 		err = props.Meta.Write(&buffer)
@@ -396,7 +477,20 @@ func (k *KedgeDownloader) AddDownload(link string, listener *MirrorListener, isS
 	return nil
 }
 
+var kedgeBackend *Backend = NewBackend("Kedge", func(ctx context.Context) (string, error) {
+	stats, err := kedge.New(".", utils.GetKedgeURL()).Stats()
+	if err != nil {
+		return "", err
+	}
+	return stats.Version, nil
+}, nil, func() bool {
+	return utils.GetTorrentEngine() == utils.TorrentEngineKedge
+})
+
 func NewKedgeDownload(link string, listener *MirrorListener, isSeed bool) error {
+	if err := kedgeBackend.Ensure(); err != nil {
+		return err
+	}
 	kedgeDownloader := NewKedgeDownloader(kedge.New(".", utils.GetKedgeURL()), &http.Client{}, utils.GetKedgeURL())
 	return kedgeDownloader.AddDownload(link, listener, isSeed)
 }
@@ -497,7 +591,7 @@ func (k *KedgeDownloadStatus) Percentage() float32 {
 func (k *KedgeDownloadStatus) ETA() *time.Duration {
 	if k.kedgeListener.IsSeeding {
 		if k.CompletedLength() >= k.TotalLength() {
-			dur := time.Now().Sub(k.kedgeListener.SeedStartTime)
+			dur := k.listener.GetSeedTime()
 			return &dur
 		}
 	}
@@ -565,6 +659,51 @@ func (k *KedgeDownloadStatus) Index() int {
 	return k.Index_
 }
 
+func (k *KedgeDownloadStatus) GetDetails() string {
+	var stats *TorrentStatus
+	if k.lastStats != nil {
+		stats = k.lastStats
+	} else {
+		stats = k.pullStatus()
+	}
+	var ratio float64
+	if stats.TotalDone != 0 {
+		ratio = float64(stats.AllTimeUpload) / float64(stats.TotalDone)
+	}
+	out := "<b>Torrent</b>\n"
+	out += fmt.Sprintf("InfoHash: <code>%s</code>\n", k.props.Spec.InfoHash.HexString())
+	out += fmt.Sprintf("State: <code>%d</code> | Errc: <code>%d</code>\n", stats.State, stats.Errc)
+	out += fmt.Sprintf("Tracker: <code>%s</code>\n", html.EscapeString(stats.CurrentTracker))
+	if stats.NextAnnounce != 0 {
+		out += fmt.Sprintf("NextAnnounce: <code>%s</code>\n", utils.HumanizeDuration(time.Duration(stats.NextAnnounce)*time.Second))
+	}
+	out += fmt.Sprintf("Trackers (spec): <code>%d</code>\n", len(k.props.Spec.Trackers))
+	out += fmt.Sprintf("Peers: <code>%d</code> | Seeds: <code>%d</code> | Connections: <code>%d</code>\n", stats.NumPeers, stats.NumSeeds, stats.NumConnections)
+	out += fmt.Sprintf("Swarm: <code>%d</code> complete, <code>%d</code> incomplete\n", stats.NumComplete, stats.NumIncomplete)
+	out += fmt.Sprintf("Ratio: <code>%.3f</code> (up <code>%s</code>, down <code>%s</code>)\n", ratio, utils.GetHumanBytes(stats.AllTimeUpload), utils.GetHumanBytes(stats.AllTimeDownload))
+	out += fmt.Sprintf("Pieces: <code>%d/%d</code>\n", stats.NumPieces, k.PiecesTotal())
+	out += fmt.Sprintf("Availability: <code>%d.%03d</code>\n", stats.DistributedFullCopies, stats.DistributedFraction)
+	out += fmt.Sprintf("Rates: <code>%s/s</code> down, <code>%s/s</code> up\n", utils.GetHumanBytes(stats.DownloadRate), utils.GetHumanBytes(stats.UploadRate))
+	out += fmt.Sprintf("Wasted: <code>%s</code> failed, <code>%s</code> redundant\n", utils.GetHumanBytes(stats.TotalFailedBytes), utils.GetHumanBytes(stats.TotalRedundantBytes))
+	out += fmt.Sprintf("ActiveDuration: <code>%s</code>", utils.HumanizeDuration(time.Duration(stats.ActiveDuration)*time.Second))
+	if stats.SeedingDuration != 0 {
+		out += fmt.Sprintf(" | SeedingDuration: <code>%s</code>", utils.HumanizeDuration(time.Duration(stats.SeedingDuration)*time.Second))
+	}
+	return out
+}
+
+func (k *KedgeDownloadStatus) GetSeedRatio() float64 {
+	return k.kedgeListener.GetRatio(k.TotalLength())
+}
+
+func (k *KedgeDownloadStatus) GetSeedPolicy() *SeedPolicy {
+	return k.listener.GetSeedPolicy()
+}
+
+func (k *KedgeDownloadStatus) GetSeedTimeRemaining() *time.Duration {
+	return k.listener.GetSeedPolicy().RemainingTime(k.listener.GetSeedTime())
+}
+
 func (k *KedgeDownloadStatus) cacheLastStatus() {
 	k.lastStats = k.pullStatus()
 }
@@ -582,8 +721,8 @@ func (k *KedgeDownloadStatus) CancelMirror() bool {
 		L().Errorf("kedge cancelMirror: %v", err)
 	}
 	if k.kedgeListener.IsSeeding {
-		ratio := float32(stats.TotalUpload) / float32(stats.TotalWanted)
-		k.kedgeListener.OnSeedingError(ratio)
+		ratio := float64(stats.TotalUpload) / float64(stats.TotalWanted)
+		k.kedgeListener.OnSeedingError(fmt.Errorf("Cancelled by user"), ratio)
 	} else {
 		k.kedgeListener.OnDownloadStop(fmt.Errorf("canceled by user"))
 	}
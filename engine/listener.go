@@ -6,12 +6,39 @@ import (
 	"path"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
+const (
+	MirrorSourceTelegram    = "Telegram"
+	MirrorSourceUsenet      = "Usenet"
+	MirrorSourceGoogleDrive = "Google Drive"
+	MirrorSourceMega        = "Mega"
+	MirrorSourceTorrent     = "Torrent"
+	MirrorSourceHTTP        = "HTTP"
+	MirrorSourceFTP         = "FTP"
+	MirrorSourceSFTP        = "SFTP"
+	MirrorSourceWebDAV      = "WebDAV"
+	MirrorSourceMedia       = "Media"
+)
+
+type MirrorPhase struct {
+	Name      string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+func (p *MirrorPhase) Elapsed() time.Duration {
+	if p.EndTime.IsZero() {
+		return time.Now().Sub(p.StartTime)
+	}
+	return p.EndTime.Sub(p.StartTime)
+}
+
 type MirrorListener struct {
 	Update         *ext.Context
 	bot            *gotgbot.Bot
@@ -22,6 +49,106 @@ type MirrorListener struct {
 	parentId       string
 	customParentId bool
 	isCanceled     bool
+	isUploadDone   bool
+	seedStartTime  time.Time
+	seedPolicy     *SeedPolicy
+	sourceType     string
+	sourceLink     string
+	startTime      time.Time
+	phases         []*MirrorPhase
+	phasesMut      sync.Mutex
+}
+
+func (m *MirrorListener) SetSource(sourceType string, link string) {
+	m.sourceType = sourceType
+	m.sourceLink = link
+}
+
+func (m *MirrorListener) SetSeedPolicy(policy *SeedPolicy) {
+	m.seedPolicy = policy
+}
+
+func (m *MirrorListener) GetSeedPolicy() *SeedPolicy {
+	if m.seedPolicy == nil {
+		m.seedPolicy = NewDefaultSeedPolicy()
+	}
+	return m.seedPolicy
+}
+
+// IsUploadDone : true once the upload finished either way, seeding limits are only enforced after that
+func (m *MirrorListener) IsUploadDone() bool {
+	m.phasesMut.Lock()
+	defer m.phasesMut.Unlock()
+	return m.isUploadDone
+}
+
+// setUploadDone : the torrent seeds while it uploads too, but the seed time of the policy only counts from here
+func (m *MirrorListener) setUploadDone() {
+	m.phasesMut.Lock()
+	defer m.phasesMut.Unlock()
+	m.isUploadDone = true
+	m.seedStartTime = time.Now()
+}
+
+// GetSeedTime : time spent seeding after the upload, zero while it is still uploading
+func (m *MirrorListener) GetSeedTime() time.Duration {
+	m.phasesMut.Lock()
+	defer m.phasesMut.Unlock()
+	if !m.isUploadDone {
+		return 0
+	}
+	return time.Since(m.seedStartTime)
+}
+
+func (m *MirrorListener) GetSourceType() string {
+	return m.sourceType
+}
+
+func (m *MirrorListener) GetSourceLink() string {
+	return m.sourceLink
+}
+
+func (m *MirrorListener) GetStartTime() time.Time {
+	return m.startTime
+}
+
+// startPhase : finishes the running phase (if any) and starts timing a new one
+func (m *MirrorListener) startPhase(name string) {
+	m.phasesMut.Lock()
+	defer m.phasesMut.Unlock()
+	now := time.Now()
+	if len(m.phases) != 0 {
+		last := m.phases[len(m.phases)-1]
+		if last.EndTime.IsZero() {
+			if last.Name == name {
+				return
+			}
+			last.EndTime = now
+		}
+	}
+	m.phases = append(m.phases, &MirrorPhase{Name: name, StartTime: now})
+}
+
+func (m *MirrorListener) endPhase() {
+	m.phasesMut.Lock()
+	defer m.phasesMut.Unlock()
+	if len(m.phases) == 0 {
+		return
+	}
+	last := m.phases[len(m.phases)-1]
+	if last.EndTime.IsZero() {
+		last.EndTime = time.Now()
+	}
+}
+
+func (m *MirrorListener) GetPhases() []MirrorPhase {
+	m.phasesMut.Lock()
+	defer m.phasesMut.Unlock()
+	var phases []MirrorPhase
+	for _, phase := range m.phases {
+		phases = append(phases, *phase)
+	}
+	return phases
 }
 
 func (m *MirrorListener) GetUid() int64 {
@@ -33,7 +160,8 @@ func (m *MirrorListener) GetDownload() MirrorStatus {
 }
 
 func (m *MirrorListener) OnDownloadStart(text string) {
-	L().Infof("Initiated Download: %s | %s | %d | %s | %s ", m.Update.Message.From.FirstName, m.Update.Message.From.Username, m.Update.Message.From.Id, text, m.Update.Message.Text)
+	L().Infof("Initiated Download: %s | %s | %d | %s | %s ", m.Update.Message.From.FirstName, m.Update.Message.From.Username, m.Update.Message.From.Id, text, utils.RedactCredentials(m.Update.Message.Text))
+	m.startPhase(MirrorStatusDownloading)
 	UpdateAllMessages(m.bot)
 }
 
@@ -57,6 +185,7 @@ func (m *MirrorListener) OnDownloadComplete() {
 		MoveMirrorToSeeding(m.GetUid(), m.GetDownload())
 	}
 	if m.isTar {
+		m.startPhase(MirrorStatusArchiving)
 		archiver := NewTarArchiver(dl.TotalLength())
 		tarStatus := NewTarStatus(dl.Gid(), dl.Name(), nil, archiver)
 		tarStatus.Index_ = dl.Index()
@@ -75,6 +204,7 @@ func (m *MirrorListener) OnDownloadComplete() {
 			L().Errorf("Failed to get archive contents size, uploading as it is: %s: %v", p, err)
 			SendMessage(m.bot, fmt.Sprintf("Failed to get archive contents size, uploading as it is: %s\nERR: %s\nGid: <code>%s</code>", dl.Name(), err.Error(), dl.Gid()), m.Update.Message)
 		} else {
+			m.startPhase(MirrorStatusUnArchiving)
 			unarchiver.SetTotal(totalSize)
 			unArchiverStatus := NewUnArchiverStatus(dl.Gid(), dl.Name(), nil, unarchiver)
 			unArchiverStatus.Index_ = dl.Index()
@@ -101,6 +231,7 @@ func (m *MirrorListener) OnDownloadComplete() {
 	} else {
 		parentId = utils.GetGDriveParentId()
 	}
+	m.startPhase(MirrorStatusUploading)
 	trGid, err := transferServiceClient.AddUpload(&UploadRequest{
 		Path:        p,
 		ParentId:    parentId,
@@ -125,6 +256,7 @@ func (m *MirrorListener) OnDownloadError(err string) {
 		return
 	}
 	m.isCanceled = true
+	m.endPhase()
 	dl := m.GetDownload()
 	if dl != nil {
 		name := dl.Name()
@@ -145,7 +277,10 @@ func (m *MirrorListener) OnUploadError(err string) {
 	size := dl.TotalLength()
 	L().Errorf("[UploadError]: %s (%d)", name, size)
 	msg := "Your upload has been stopped due to: %s"
+	m.endPhase()
+	m.setUploadDone()
 	if m.isSeed {
+		m.startPhase(MirrorStatusSeeding)
 		seedStatus := GetSeedingMirrorByUid(m.GetUid())
 		AddMirrorLocal(m.GetUid(), seedStatus)
 		RemoveMirrorSeeding(m.GetUid())
@@ -179,7 +314,10 @@ func (m *MirrorListener) OnUploadComplete(link string) {
 			msg += fmt.Sprintf("\n\nShareable Link: <a href='%s'>here</a>", inUrl)
 		}
 	}
+	m.endPhase()
+	m.setUploadDone()
 	if m.isSeed {
+		m.startPhase(MirrorStatusSeeding)
 		seedStatus := GetSeedingMirrorByUid(m.GetUid())
 		AddMirrorLocal(m.GetUid(), seedStatus)
 		RemoveMirrorSeeding(m.GetUid())
@@ -203,6 +341,7 @@ func (m *MirrorListener) OnSeedingError(err error) {
 		return
 	}
 	m.isCanceled = true
+	m.endPhase()
 	dl := m.GetDownload()
 	name := dl.Name()
 	size := dl.TotalLength()
@@ -213,6 +352,23 @@ func (m *MirrorListener) OnSeedingError(err error) {
 	m.CleanDownload()
 }
 
+// OnSeedingComplete : seed policy limits reached, torrent is already dropped from the client
+func (m *MirrorListener) OnSeedingComplete(text string) {
+	if m.isCanceled {
+		return
+	}
+	m.isCanceled = true
+	m.endPhase()
+	dl := m.GetDownload()
+	name := dl.Name()
+	size := dl.TotalLength()
+	L().Infof("[SeedComplete]: %s (%d)", name, size)
+	m.Clean()
+	msg := "Seeding finished: %s"
+	SendMessage(m.bot, fmt.Sprintf(msg, text), m.Update.Message)
+	m.CleanDownload()
+}
+
 func (m *MirrorListener) CleanDownload() {
 	err := utils.RemoveByPath(path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(m.GetUid())))
 	if err != nil {
@@ -222,7 +378,7 @@ func (m *MirrorListener) CleanDownload() {
 }
 
 func NewMirrorListener(b *gotgbot.Bot, update *ext.Context, isTar bool, doUnArchive bool, parentId string) MirrorListener {
-	return MirrorListener{bot: b, Update: update, isTar: isTar, doUnArchive: doUnArchive, parentId: parentId}
+	return MirrorListener{bot: b, Update: update, isTar: isTar, doUnArchive: doUnArchive, parentId: parentId, startTime: time.Now()}
 }
 
 type CloneListener struct {
@@ -230,6 +386,11 @@ type CloneListener struct {
 	bot        *gotgbot.Bot
 	parentId   string
 	isCanceled bool
+	startTime  time.Time
+}
+
+func (m *CloneListener) GetStartTime() time.Time {
+	return m.startTime
 }
 
 func (m *CloneListener) GetUid() int64 {
@@ -241,7 +402,7 @@ func (m *CloneListener) GetDownload() MirrorStatus {
 }
 
 func (m *CloneListener) OnCloneStart(text string) {
-	L().Infof("Initiated Clone: %s | %s | %d | %s | %s ", m.Update.Message.From.FirstName, m.Update.Message.From.Username, m.Update.Message.From.Id, text, m.Update.Message.Text)
+	L().Infof("Initiated Clone: %s | %s | %d | %s | %s ", m.Update.Message.From.FirstName, m.Update.Message.From.Username, m.Update.Message.From.Id, text, utils.RedactCredentials(m.Update.Message.Text))
 	UpdateAllMessages(m.bot)
 }
 
@@ -287,7 +448,7 @@ func (m *CloneListener) OnCloneComplete(link string) {
 }
 
 func NewCloneListener(b *gotgbot.Bot, update *ext.Context, parentId string) CloneListener {
-	return CloneListener{bot: b, Update: update, parentId: parentId}
+	return CloneListener{bot: b, Update: update, parentId: parentId, startTime: time.Now()}
 }
 
 func NewInitializingStatus(name string, gid string, dir string, listener *MirrorListener) *InitializingStatus {
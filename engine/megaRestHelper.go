@@ -3,6 +3,7 @@ package engine
 import (
 	"MirrorBotGo/utils"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -100,15 +101,18 @@ func (m *MegaSDKRestClient) checkAndRaiseError(errorCode int, errorString string
 	return nil
 }
 
-func (m *MegaSDKRestClient) checkLogin() {
+// checkLogin : callers hold mut, a failed login is tried again on the next download
+func (m *MegaSDKRestClient) checkLogin() error {
 	if megaLoggedIn {
-		return
+		return nil
 	}
 	_, err := m.Login(utils.GetMegaEmail(), utils.GetMegaPassword())
 	if err != nil {
 		L().Errorf("MegaSDKRest Login: %s", err.Error())
+		return err
 	}
 	megaLoggedIn = true
+	return nil
 }
 
 func (m *MegaSDKRestClient) Login(email string, password string) (*MegaSDKRestResp, error) {
@@ -148,9 +152,16 @@ func (m *MegaSDKRestClient) Login(email string, password string) (*MegaSDKRestRe
 }
 
 func (m *MegaSDKRestClient) AddDownload(link string, dir string) (*MegaSDKRestResp, error) {
+	err := megaBackend.Ensure()
+	if err != nil {
+		return nil, err
+	}
 	m.mut.Lock()
 	defer m.mut.Unlock()
-	m.checkLogin()
+	err = m.checkLogin()
+	if err != nil {
+		return nil, err
+	}
 	addDownloadReq := &MegaSDKRestReq{
 		Link: link,
 		Dir:  dir,
@@ -263,6 +274,16 @@ func (m *MegaSDKRestClient) GetDownloadInfo(gid string) (*MegaSDKRestDownloadInf
 }
 
 var megaClient *MegaSDKRestClient = NewMegaSDKRestClient(utils.GetMegaSDKRestServiceURL(), &http.Client{Timeout: 60 * time.Second})
+var megaBackend *Backend = NewBackend("Mega REST service", func(ctx context.Context) (string, error) {
+	return checkHTTPBackend(ctx, utils.GetMegaSDKRestServiceURL())
+}, onMegaConnect, nil)
+
+// onMegaConnect : a restarted service has forgotten the login
+func onMegaConnect() {
+	megaClient.mut.Lock()
+	defer megaClient.mut.Unlock()
+	megaLoggedIn = false
+}
 
 func PerformMegaLogin() error {
 	_, err := megaClient.Login(utils.GetMegaEmail(), utils.GetMegaPassword())
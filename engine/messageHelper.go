@@ -66,13 +66,19 @@ func DeleteMessageByChatId(chatId int64) {
 }
 
 func SendMessageImpl(b *gotgbot.Bot, messageText string, message *gotgbot.Message, markup *gotgbot.InlineKeyboardMarkup) *gotgbot.Message {
+	return sendMessageImpl(b, messageText, message, markup, true)
+}
+
+func sendMessageImpl(b *gotgbot.Bot, messageText string, message *gotgbot.Message, markup *gotgbot.InlineKeyboardMarkup, reply bool) *gotgbot.Message {
 	var retries = 1
 	var msg *gotgbot.Message
 	var err error
 	sendMessage := func() (*gotgbot.Message, error) {
 		opts := &gotgbot.SendMessageOpts{
-			ReplyToMessageId: message.MessageId,
-			ParseMode:        "HTML",
+			ParseMode: "HTML",
+		}
+		if reply {
+			opts.ReplyToMessageId = message.MessageId
 		}
 		if markup != nil {
 			opts.ReplyMarkup = *markup
@@ -118,6 +124,11 @@ func SendMessage(b *gotgbot.Bot, messageText string, message *gotgbot.Message) *
 	return SendMessageImpl(b, messageText, message, nil)
 }
 
+// SendMessageToChat : for answers to commands that were deleted, a reply to a deleted message is rejected and dropped
+func SendMessageToChat(b *gotgbot.Bot, messageText string, message *gotgbot.Message) *gotgbot.Message {
+	return sendMessageImpl(b, messageText, message, nil, false)
+}
+
 func SendMessageMarkup(b *gotgbot.Bot, messageText string, message *gotgbot.Message, markup gotgbot.InlineKeyboardMarkup) *gotgbot.Message {
 	return SendMessageImpl(b, messageText, message, &markup)
 }
@@ -250,15 +261,20 @@ func GetStatsString() string {
 	return outStr
 }
 
-func GetReadableProgressMessage(page int) string {
+func GetReadableProgressMessage(view *StatusView) string {
 	var globalDownloadSpeed int64
 	var globalUploadSpeed int64
 	msg := ""
-	chunks := GetAllMirrorsChunked(StatusMessageChunkSize)
+	chunks := view.GetMirrorsChunked(StatusMessageChunkSize)
+	page := view.GetPage()
 	if len(chunks)-1 < page {
 		page = len(chunks) - 1
+		view.SetPage(page)
 	}
 	dls := chunks[page]
+	if len(dls) == 0 {
+		msg += "No mirrors match the current filter\n\n"
+	}
 	for i := 0; i <= len(dls)-1; i++ {
 		dl := dls[i]
 		msg += fmt.Sprintf("<i>%s</i> -", dl.Name())
@@ -295,6 +311,9 @@ func GetReadableProgressMessage(page int) string {
 			if dl.IsTorrent() {
 				msg += fmt.Sprintf(" | P: %d | S: %d | PC: %d/%d", dl.GetPeers(), dl.GetSeeders(), dl.PiecesCompleted(), dl.PiecesTotal())
 			}
+			if seeder, ok := dl.(SeedingStatus); ok && dl.GetStatusType() == MirrorStatusSeeding {
+				msg += GetSeedingStatusString(seeder)
+			}
 			msg += fmt.Sprintf("\nGID: <code>%s</code> ", dls[i].Gid())
 			msg += fmt.Sprintf("I: <code>%d</code>", dls[i].Index())
 
@@ -346,26 +365,22 @@ func SendStatusMessage(b *gotgbot.Bot, message *gotgbot.Message, deleteCommandMe
 				DeleteMessage(b, msg)
 			}
 		}()
+		view := GetStatusView(message.Chat.Id)
+		view.SetPage(0)
 		if GetAllMirrorsCount()+GetAllSeedingMirrorsCount() == 0 {
 			progress = "No active mirrors"
+			newMsg = SendMessage(b, progress, message)
 		} else {
-			progress = GetReadableProgressMessage(0)
+			progress = GetReadableProgressMessage(view)
+			chunks := view.GetMirrorsChunked(StatusMessageChunkSize)
+			newMsg = SendMessageMarkup(b, progress, message, GetStatusViewMarkup(view, false, len(chunks) > 1, "0", utils.ParseIntToString(len(chunks)-1)))
 		}
-		if GetAllMirrorsCount() > StatusMessageChunkSize {
-			newMsg = SendMessageMarkup(b, progress, message, GetPaginationMarkup(false, true, "0", utils.ParseIntToString(len(GetAllMirrorsChunked(StatusMessageChunkSize))-1)))
-			if newMsg == nil {
-				return FailedToSendMessageError
-			}
-		} else {
-			newMsg = SendMessage(b, progress, message)
-			if newMsg == nil {
-				return FailedToSendMessageError
-			}
+		if newMsg == nil {
+			return FailedToSendMessageError
 		}
 		if deleteCommandMessage {
 			DeleteMessage(b, message)
 		}
-		newMsg.Date = 0
 		AddStatusMessage(newMsg)
 		duration := utils.GetStatusMessageAutoDeleteTime()
 		if duration > 0 {
@@ -398,7 +413,6 @@ func AutoDeleteMessages(b *gotgbot.Bot, timeout time.Duration, messages ...*gotg
 }
 
 func UpdateAllMessages(b *gotgbot.Bot) {
-	mirrorsCount := GetAllMirrorsCount()
 	for _, msg := range GetAllMessages() {
 		var previous bool
 		var next bool
@@ -407,25 +421,19 @@ func UpdateAllMessages(b *gotgbot.Bot) {
 			progress = "No active mirrors"
 			EditMessage(b, progress, msg)
 			continue
-		} else {
-			progress = GetReadableProgressMessage(int(msg.Date))
 		}
+		view := GetStatusView(msg.Chat.Id)
+		progress = GetReadableProgressMessage(view)
 		if msg.Text != progress {
-			chunks := GetAllMirrorsChunked(StatusMessageChunkSize)
-			if mirrorsCount > StatusMessageChunkSize {
-				if msg.Date > int64(len(chunks)) {
-					msg.Date = int64(len(chunks)) - 1
-				}
-				if msg.Date > 0 {
-					previous = true
-				}
-				if len(chunks) > int(msg.Date)+1 {
-					next = true
-				}
-				EditMessageMarkup(b, progress, msg, GetPaginationMarkup(previous, next, utils.ParseInt64ToString(msg.Date), utils.ParseIntToString(len(chunks)-int(msg.Date)-1)))
-			} else {
-				EditMessage(b, progress, msg)
+			chunks := view.GetMirrorsChunked(StatusMessageChunkSize)
+			page := view.GetPage()
+			if page > 0 {
+				previous = true
+			}
+			if len(chunks) > page+1 {
+				next = true
 			}
+			EditMessageMarkup(b, progress, msg, GetStatusViewMarkup(view, previous, next, utils.ParseIntToString(page), utils.ParseIntToString(len(chunks)-page-1)))
 			msg.Text = progress
 		}
 	}
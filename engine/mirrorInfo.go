@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"fmt"
+	"html"
+	"time"
+)
+
+// MirrorDetailsProvider : implemented by the statuses which can report source specific details, used by /info
+type MirrorDetailsProvider interface {
+	GetDetails() string
+}
+
+func GetMirrorInfoString(dl MirrorStatus) string {
+	out := ""
+	out += fmt.Sprintf("Name: <code>%s</code>\n", html.EscapeString(dl.Name()))
+	out += fmt.Sprintf("GID: <code>%s</code> I: <code>%d</code>\n", dl.Gid(), dl.Index())
+	out += fmt.Sprintf("Status: <code>%s</code>\n", dl.GetStatusType())
+	out += fmt.Sprintf("Progress: <code>%s of %s (%.2f%%)</code>\n", utils.GetHumanBytes(dl.CompletedLength()), utils.GetHumanBytes(dl.TotalLength()), dl.Percentage())
+	out += fmt.Sprintf("Speed: <code>%s/s</code>\n", utils.GetHumanBytes(dl.Speed()))
+	listener := dl.GetListener()
+	cloneListener := dl.GetCloneListener()
+	if listener != nil {
+		sourceType := listener.GetSourceType()
+		if sourceType == "" {
+			sourceType = "Unknown"
+		}
+		out += fmt.Sprintf("Source: <code>%s</code>\n", sourceType)
+		if listener.GetSourceLink() != "" {
+			out += fmt.Sprintf("Link: <code>%s</code>\n", html.EscapeString(listener.GetSourceLink()))
+		}
+	} else if cloneListener != nil {
+		out += fmt.Sprintf("Source: <code>%s clone</code>\n", MirrorSourceGoogleDrive)
+	}
+	msg := GetMirrorMessage(dl)
+	if msg != nil && msg.From != nil {
+		out += fmt.Sprintf("Requester: <code>%s %s</code> (<code>%d</code>)\n", html.EscapeString(msg.From.FirstName), html.EscapeString(msg.From.LastName), msg.From.Id)
+	}
+	if listener != nil {
+		out += fmt.Sprintf("Elapsed: <code>%s</code>\n", utils.HumanizeDuration(time.Now().Sub(listener.GetStartTime())))
+		for _, phase := range listener.GetPhases() {
+			state := ""
+			if phase.EndTime.IsZero() {
+				state = " (running)"
+			}
+			out += fmt.Sprintf(" ⁍ %s: <code>%s</code>%s\n", phase.Name, utils.HumanizeDuration(phase.Elapsed()), state)
+		}
+	} else if cloneListener != nil {
+		out += fmt.Sprintf("Elapsed: <code>%s</code>\n", utils.HumanizeDuration(time.Now().Sub(cloneListener.GetStartTime())))
+	}
+	detailer, ok := dl.(MirrorDetailsProvider)
+	if ok {
+		details := detailer.GetDetails()
+		if details != "" {
+			out += "\n" + details
+		}
+	}
+	return out
+}
@@ -3,6 +3,8 @@ package engine
 import (
 	"sort"
 	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
 var dlMutex sync.Mutex
@@ -26,6 +28,11 @@ const (
 	MirrorStatusFailed       = "Failed"
 	MirrorStatusCanceled     = "Cancelled"
 	MirrorStatusUploadQueued = "Queued for upload"
+	// usenet post-processing stages
+	MirrorStatusVerifying      = "Verifying"
+	MirrorStatusRepairing      = "Repairing"
+	MirrorStatusUnpacking      = "Unpacking"
+	MirrorStatusPostProcessing = "Post-processing"
 )
 
 func getMap() map[int64]MirrorStatus {
@@ -87,6 +94,19 @@ func GetSeedingMirrorByUid(uid int64) MirrorStatus {
 	return nil
 }
 
+// GetMirrorMessage : returns the command message which started this mirror or clone
+func GetMirrorMessage(dl MirrorStatus) *gotgbot.Message {
+	listener := dl.GetListener()
+	if listener != nil && listener.Update != nil {
+		return listener.Update.Message
+	}
+	cloneListener := dl.GetCloneListener()
+	if cloneListener != nil && cloneListener.Update != nil {
+		return cloneListener.Update.Message
+	}
+	return nil
+}
+
 func GetAllMirrorsCount() int {
 	return len(GetAllMirrors())
 }
@@ -140,9 +160,12 @@ func GenerateMirrorIndex() int {
 	return GlobalMirrorIndex
 }
 
-func GetAllMirrorsChunked(chunkSize int) (chunks [][]MirrorStatus) {
+func GetAllMirrorsChunked(chunkSize int) [][]MirrorStatus {
+	return ChunkMirrors(GetAllMirrors(), chunkSize)
+}
+
+func ChunkMirrors(items []MirrorStatus, chunkSize int) (chunks [][]MirrorStatus) {
 	//While there are more items remaining than chunkSize...
-	items := GetAllMirrors()
 	for chunkSize < len(items) {
 		//We take a slice of size chunkSize from the items array and append it to the new array
 		chunks = append(chunks, items[0:chunkSize])
@@ -0,0 +1,335 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// remoteFile : a file to fetch, relPath is where it goes below the download directory
+type remoteFile struct {
+	remotePath string
+	relPath    string
+	size       int64
+}
+
+// RemoteDownload : fetches a file or a whole directory tree from an ftp, sftp or webdav server, one file at a time
+type RemoteDownload struct {
+	fs          RemoteFs
+	scheme      string
+	host        string
+	name        string
+	files       []remoteFile
+	total       int64
+	completed   int64
+	speed       int64
+	current     atomic.Value
+	filesDone   int64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	listener    *MirrorListener
+	isCancelled bool
+}
+
+func listRemoteFiles(fs RemoteFs, remotePath string, relPath string, files []remoteFile) ([]remoteFile, error) {
+	entries, err := fs.ReadDir(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %v", remotePath, err)
+	}
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." || entry.Name == "" {
+			continue
+		}
+		// names come from the server, keep them inside the download directory
+		name := path.Base(path.Clean("/" + entry.Name))
+		if entry.IsDir {
+			files, err = listRemoteFiles(fs, path.Join(remotePath, entry.Name), path.Join(relPath, name), files)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		files = append(files, remoteFile{
+			remotePath: path.Join(remotePath, entry.Name),
+			relPath:    path.Join(relPath, name),
+			size:       entry.Size,
+		})
+	}
+	return files, nil
+}
+
+func NewRemoteDownloadFromLink(link string, listener *MirrorListener, secrets map[string]string) (*RemoteDownload, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	fs, err := NewRemoteFs(u, GetRemoteCredentials(u, secrets))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", u.Scheme, err)
+	}
+	remotePath := u.Path
+	if remotePath == "" {
+		remotePath = "/"
+	}
+	root, err := fs.Stat(remotePath)
+	if err != nil {
+		fs.Close()
+		return nil, fmt.Errorf("%s: %s: %v", u.Scheme, remotePath, err)
+	}
+	name := path.Base(path.Clean("/" + remotePath))
+	if name == "/" {
+		name = u.Hostname()
+	}
+	var files []remoteFile
+	if root.IsDir {
+		files, err = listRemoteFiles(fs, remotePath, name, nil)
+		if err != nil {
+			fs.Close()
+			return nil, err
+		}
+		if len(files) == 0 {
+			fs.Close()
+			return nil, fmt.Errorf("%s: %s is empty", u.Scheme, remotePath)
+		}
+	} else {
+		files = []remoteFile{{remotePath: remotePath, relPath: name, size: root.Size}}
+	}
+	r := &RemoteDownload{
+		fs:       fs,
+		scheme:   u.Scheme,
+		host:     u.Host,
+		name:     name,
+		files:    files,
+		listener: listener,
+	}
+	for _, file := range files {
+		r.total += file.size
+	}
+	r.current.Store("")
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	return r, nil
+}
+
+// remoteProgressReader : counts bytes and aborts the copy once the download is cancelled
+type remoteProgressReader struct {
+	reader io.Reader
+	r      *RemoteDownload
+}
+
+func (p *remoteProgressReader) Read(buf []byte) (int, error) {
+	if err := p.r.ctx.Err(); err != nil {
+		return 0, fmt.Errorf("download cancelled")
+	}
+	n, err := p.reader.Read(buf)
+	atomic.AddInt64(&p.r.completed, int64(n))
+	return n, err
+}
+
+func (r *RemoteDownload) downloadFile(dir string, file remoteFile) error {
+	r.current.Store(file.relPath)
+	target := path.Join(dir, file.relPath)
+	err := os.MkdirAll(path.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	reader, err := r.fs.Open(file.remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", file.remotePath, err)
+	}
+	// the watcher and the defer may both close, the reader of an ftp server must not be closed twice or concurrently
+	var closeOnce sync.Once
+	closeReader := func() {
+		closeOnce.Do(func() {
+			reader.Close()
+		})
+	}
+	defer closeReader()
+	writer, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	// closing the reader unblocks a read stuck on a stalled server
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.ctx.Done():
+			closeReader()
+		case <-done:
+		}
+	}()
+	_, err = io.Copy(writer, &remoteProgressReader{reader: reader, r: r})
+	if err != nil {
+		if r.ctx.Err() != nil {
+			return fmt.Errorf("download cancelled")
+		}
+		return fmt.Errorf("failed to download %s: %v", file.remotePath, err)
+	}
+	atomic.AddInt64(&r.filesDone, 1)
+	return nil
+}
+
+func (r *RemoteDownload) speedObserver() {
+	last := atomic.LoadInt64(&r.completed)
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			completed := atomic.LoadInt64(&r.completed)
+			atomic.StoreInt64(&r.speed, completed-last)
+			last = completed
+		}
+	}
+}
+
+func (r *RemoteDownload) Start() {
+	dir := path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(r.listener.GetUid()))
+	go r.speedObserver()
+	go func() {
+		defer r.cancel()
+		defer r.fs.Close()
+		for _, file := range r.files {
+			err := r.downloadFile(dir, file)
+			if err != nil {
+				L().Errorf("[RemoteDownload] %s://%s: %v", r.scheme, r.host, err)
+				r.listener.OnDownloadError(err.Error())
+				return
+			}
+		}
+		r.listener.OnDownloadComplete()
+	}()
+}
+
+func NewRemoteDownload(link string, listener *MirrorListener, secrets map[string]string) error {
+	r, err := NewRemoteDownloadFromLink(link, listener, secrets)
+	if err != nil {
+		return err
+	}
+	status := NewRemoteDownloadStatus(r, utils.RandString(16))
+	status.Index_ = GenerateMirrorIndex()
+	AddMirrorLocal(listener.GetUid(), status)
+	listener.OnDownloadStart(status.Gid())
+	r.Start()
+	return nil
+}
+
+func NewRemoteDownloadStatus(r *RemoteDownload, gid string) *RemoteDownloadStatus {
+	return &RemoteDownloadStatus{
+		r:   r,
+		gid: gid,
+	}
+}
+
+type RemoteDownloadStatus struct {
+	r      *RemoteDownload
+	gid    string
+	Index_ int
+}
+
+func (s *RemoteDownloadStatus) Name() string {
+	return s.r.name
+}
+
+func (s *RemoteDownloadStatus) CompletedLength() int64 {
+	return atomic.LoadInt64(&s.r.completed)
+}
+
+func (s *RemoteDownloadStatus) TotalLength() int64 {
+	return s.r.total
+}
+
+func (s *RemoteDownloadStatus) Speed() int64 {
+	return atomic.LoadInt64(&s.r.speed)
+}
+
+func (s *RemoteDownloadStatus) ETA() *time.Duration {
+	if s.Speed() != 0 {
+		dur := utils.CalculateETA(s.TotalLength()-s.CompletedLength(), s.Speed())
+		return &dur
+	}
+	dur := time.Duration(0)
+	return &dur
+}
+
+func (s *RemoteDownloadStatus) Gid() string {
+	return s.gid
+}
+
+func (s *RemoteDownloadStatus) Path() string {
+	return path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(s.GetListener().GetUid()), s.Name())
+}
+
+func (s *RemoteDownloadStatus) Percentage() float32 {
+	if s.TotalLength() == 0 {
+		return float32(0)
+	}
+	return float32(s.CompletedLength()*100) / float32(s.TotalLength())
+}
+
+func (s *RemoteDownloadStatus) GetStatusType() string {
+	if s.r.isCancelled {
+		return MirrorStatusCanceled
+	}
+	return MirrorStatusDownloading
+}
+
+func (s *RemoteDownloadStatus) IsTorrent() bool {
+	return false
+}
+
+func (s *RemoteDownloadStatus) PiecesCompleted() int {
+	return 0
+}
+
+func (s *RemoteDownloadStatus) PiecesTotal() int {
+	return 0
+}
+
+func (s *RemoteDownloadStatus) GetPeers() int {
+	return 0
+}
+
+func (s *RemoteDownloadStatus) GetSeeders() int {
+	return 0
+}
+
+func (s *RemoteDownloadStatus) Index() int {
+	return s.Index_
+}
+
+func (s *RemoteDownloadStatus) GetListener() *MirrorListener {
+	return s.r.listener
+}
+
+func (s *RemoteDownloadStatus) GetCloneListener() *CloneListener {
+	return nil
+}
+
+func (s *RemoteDownloadStatus) CancelMirror() bool {
+	s.r.isCancelled = true
+	s.r.cancel()
+	return true
+}
+
+func (s *RemoteDownloadStatus) GetDetails() string {
+	out := fmt.Sprintf("<b>%s</b>\n", strings.ToUpper(s.r.scheme))
+	out += fmt.Sprintf("Host: <code>%s</code>\n", html.EscapeString(s.r.host))
+	out += fmt.Sprintf("Files: <code>%d/%d</code>", atomic.LoadInt64(&s.r.filesDone), len(s.r.files))
+	if current, _ := s.r.current.Load().(string); current != "" && len(s.r.files) > 1 {
+		out += fmt.Sprintf("\nCurrent: <code>%s</code>", html.EscapeString(current))
+	}
+	return out
+}
@@ -0,0 +1,340 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jlaffaye/ftp"
+	"github.com/pkg/sftp"
+	"github.com/studio-b12/gowebdav"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const RemoteFsDialTimeout = 30 * time.Second
+
+type RemoteEntry struct {
+	Name  string
+	Size  int64
+	IsDir bool
+}
+
+// RemoteFs : the operations a RemoteDownload needs from an ftp, sftp or webdav server, calls are never concurrent
+type RemoteFs interface {
+	Stat(p string) (*RemoteEntry, error)
+	ReadDir(p string) ([]*RemoteEntry, error)
+	Open(p string) (io.ReadCloser, error)
+	Close() error
+}
+
+// RemoteCredentials : password doubles as the private key passphrase for sftp
+type RemoteCredentials struct {
+	User       string
+	Password   string
+	PrivateKey string
+}
+
+func IsRemoteFsLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "ftp", "ftps", "sftp", "webdav", "webdavs":
+		return true
+	}
+	return false
+}
+
+// GetRemoteCredentials : inline user:password wins, otherwise the secret named scheme://host holds user:password,
+// sftp private keys are looked up in the secret scheme://host/key
+func GetRemoteCredentials(u *url.URL, secrets map[string]string) *RemoteCredentials {
+	credentials := &RemoteCredentials{}
+	secretName := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	if value, ok := secrets[secretName]; ok {
+		credentials.User, credentials.Password, _ = strings.Cut(value, ":")
+	}
+	if key, ok := secrets[secretName+"/key"]; ok {
+		credentials.PrivateKey = key
+	}
+	if u.User != nil {
+		credentials.User = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			credentials.Password = password
+		}
+	}
+	return credentials
+}
+
+func GetRemoteFsSource(link string) string {
+	switch {
+	case strings.HasPrefix(link, "sftp://"):
+		return MirrorSourceSFTP
+	case strings.HasPrefix(link, "webdav"):
+		return MirrorSourceWebDAV
+	}
+	return MirrorSourceFTP
+}
+
+func NewRemoteFs(u *url.URL, credentials *RemoteCredentials) (RemoteFs, error) {
+	switch u.Scheme {
+	case "ftp", "ftps":
+		return newFtpFs(u, credentials)
+	case "sftp":
+		return newSftpFs(u, credentials)
+	case "webdav", "webdavs":
+		return newWebdavFs(u, credentials)
+	}
+	return nil, fmt.Errorf("unsupported scheme: %s", u.Scheme)
+}
+
+func hostWithDefaultPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+type ftpFs struct {
+	conn *ftp.ServerConn
+}
+
+func newFtpFs(u *url.URL, credentials *RemoteCredentials) (*ftpFs, error) {
+	options := []ftp.DialOption{ftp.DialWithTimeout(RemoteFsDialTimeout)}
+	if u.Scheme == "ftps" {
+		options = append(options, ftp.DialWithExplicitTLS(&tls.Config{ServerName: u.Hostname()}))
+	}
+	conn, err := ftp.Dial(hostWithDefaultPort(u, "21"), options...)
+	if err != nil {
+		return nil, err
+	}
+	user, password := credentials.User, credentials.Password
+	if user == "" {
+		user, password = "anonymous", "anonymous"
+	}
+	err = conn.Login(user, password)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	return &ftpFs{conn: conn}, nil
+}
+
+// Stat : plain ftp has no stat, a path we can change into is a directory
+func (f *ftpFs) Stat(p string) (*RemoteEntry, error) {
+	current, err := f.conn.CurrentDir()
+	if err != nil {
+		return nil, err
+	}
+	if f.conn.ChangeDir(p) == nil {
+		err = f.conn.ChangeDir(current)
+		return &RemoteEntry{Name: path.Base(p), IsDir: true}, err
+	}
+	size, err := f.conn.FileSize(p)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteEntry{Name: path.Base(p), Size: size}, nil
+}
+
+func (f *ftpFs) ReadDir(p string) ([]*RemoteEntry, error) {
+	entries, err := f.conn.List(p)
+	if err != nil {
+		return nil, err
+	}
+	var out []*RemoteEntry
+	for _, entry := range entries {
+		switch entry.Type {
+		case ftp.EntryTypeFile:
+			out = append(out, &RemoteEntry{Name: entry.Name, Size: int64(entry.Size)})
+		case ftp.EntryTypeFolder:
+			out = append(out, &RemoteEntry{Name: entry.Name, IsDir: true})
+		}
+	}
+	return out, nil
+}
+
+func (f *ftpFs) Open(p string) (io.ReadCloser, error) {
+	return f.conn.Retr(p)
+}
+
+func (f *ftpFs) Close() error {
+	return f.conn.Quit()
+}
+
+type sftpFs struct {
+	sshClient *ssh.Client
+	client    *sftp.Client
+}
+
+// sftpPinnedHostsFile : known_hosts file the bot keeps itself when sftp_known_hosts_file is not set
+const sftpPinnedHostsFile = "sftp_pinned_hosts"
+
+var sftpPinMut sync.Mutex
+
+// getSftpHostKeyCallback : a configured known_hosts file is only read, without one the key of each host is pinned on first connect
+func getSftpHostKeyCallback() (ssh.HostKeyCallback, error) {
+	file := utils.GetSftpKnownHostsFile()
+	if file != "" {
+		return knownhosts.New(file)
+	}
+	return pinSftpHostKey, nil
+}
+
+// pinSftpHostKey : trust on first use, a host that later shows another key is refused
+func pinSftpHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	sftpPinMut.Lock()
+	defer sftpPinMut.Unlock()
+	file, err := os.OpenFile(sftpPinnedHostsFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("sftp: failed to open %s: %v", sftpPinnedHostsFile, err)
+	}
+	defer file.Close()
+	callback, err := knownhosts.New(sftpPinnedHostsFile)
+	if err != nil {
+		return fmt.Errorf("sftp: failed to read %s: %v", sftpPinnedHostsFile, err)
+	}
+	err = callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if err == nil || !errors.As(err, &keyErr) {
+		return err
+	}
+	if len(keyErr.Want) > 0 {
+		return fmt.Errorf("sftp: host key of %s changed to %s, it does not match the one pinned in %s", hostname, ssh.FingerprintSHA256(key), sftpPinnedHostsFile)
+	}
+	_, err = file.WriteString(knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n")
+	if err != nil {
+		return fmt.Errorf("sftp: failed to pin the host key of %s: %v", hostname, err)
+	}
+	L().Infof("sftp: pinned host key of %s: %s", hostname, ssh.FingerprintSHA256(key))
+	return nil
+}
+
+func newSftpFs(u *url.URL, credentials *RemoteCredentials) (*sftpFs, error) {
+	if credentials.User == "" {
+		return nil, fmt.Errorf("sftp needs a user, put it in the link or in the secret %s://%s", u.Scheme, u.Host)
+	}
+	var auth []ssh.AuthMethod
+	if credentials.PrivateKey != "" {
+		var signer ssh.Signer
+		var err error
+		if credentials.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(credentials.PrivateKey), []byte(credentials.Password))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(credentials.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sftp: invalid private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if credentials.Password != "" {
+		auth = append(auth, ssh.Password(credentials.Password))
+	}
+	hostKeyCallback, err := getSftpHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+	sshClient, err := ssh.Dial("tcp", hostWithDefaultPort(u, "22"), &ssh.ClientConfig{
+		User:            credentials.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         RemoteFsDialTimeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	return &sftpFs{sshClient: sshClient, client: client}, nil
+}
+
+func fileInfoToRemoteEntry(info os.FileInfo) *RemoteEntry {
+	return &RemoteEntry{Name: info.Name(), Size: info.Size(), IsDir: info.IsDir()}
+}
+
+func (s *sftpFs) Stat(p string) (*RemoteEntry, error) {
+	info, err := s.client.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfoToRemoteEntry(info), nil
+}
+
+func (s *sftpFs) ReadDir(p string) ([]*RemoteEntry, error) {
+	infos, err := s.client.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	var out []*RemoteEntry
+	for _, info := range infos {
+		if info.IsDir() || info.Mode().IsRegular() {
+			out = append(out, fileInfoToRemoteEntry(info))
+		}
+	}
+	return out, nil
+}
+
+func (s *sftpFs) Open(p string) (io.ReadCloser, error) {
+	return s.client.Open(p)
+}
+
+func (s *sftpFs) Close() error {
+	s.client.Close()
+	return s.sshClient.Close()
+}
+
+type webdavFs struct {
+	client *gowebdav.Client
+}
+
+func newWebdavFs(u *url.URL, credentials *RemoteCredentials) (*webdavFs, error) {
+	scheme := "http"
+	if u.Scheme == "webdavs" {
+		scheme = "https"
+	}
+	client := gowebdav.NewClient(fmt.Sprintf("%s://%s", scheme, u.Host), credentials.User, credentials.Password)
+	client.SetHeader("User-Agent", utils.GetHttpUserAgent())
+	return &webdavFs{client: client}, nil
+}
+
+func (w *webdavFs) Stat(p string) (*RemoteEntry, error) {
+	info, err := w.client.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfoToRemoteEntry(info), nil
+}
+
+func (w *webdavFs) ReadDir(p string) ([]*RemoteEntry, error) {
+	infos, err := w.client.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	var out []*RemoteEntry
+	for _, info := range infos {
+		out = append(out, fileInfoToRemoteEntry(info))
+	}
+	return out, nil
+}
+
+func (w *webdavFs) Open(p string) (io.ReadCloser, error) {
+	return w.client.ReadStream(p)
+}
+
+func (w *webdavFs) Close() error {
+	return nil
+}
@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ResolverMaxPageSize : pages fetched by the generic resolver are only scanned up to this size
+const ResolverMaxPageSize = 5 * 1024 * 1024
+
+// ErrNotResolvable : a resolver claimed the link but found nothing to rewrite it to, the link is downloaded as is
+var ErrNotResolvable = errors.New("nothing to resolve")
+
+// Resolver : native counterpart of a js extractor for hosts common enough to be supported out of the box
+type Resolver interface {
+	Name() string
+	Description() string
+	Match(u *url.URL) bool
+	Resolve(client *http.Client, u *url.URL) (*ExtractResult, error)
+}
+
+// nativeResolvers run before js extractors, fallbackResolvers match almost anything so they run after them
+var nativeResolvers = []Resolver{
+	&DropboxResolver{},
+	&OneDriveResolver{},
+	&GitHubReleaseResolver{},
+}
+
+var fallbackResolvers = []Resolver{
+	&PageMediaResolver{},
+}
+
+const resolverTimeout = 30 * time.Second
+
+func GetResolvers() []Resolver {
+	return append(append([]Resolver(nil), nativeResolvers...), fallbackResolvers...)
+}
+
+// resolveWith : resolvers reach the link the way the download will, through the proxy, user agent and credentials of the mirror
+func resolveWith(resolvers []Resolver, link string, options *HTTPRequestOptions) (*ExtractResult, Resolver, error) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, nil, ErrNotResolvable
+	}
+	for _, resolver := range resolvers {
+		if !resolver.Match(u) {
+			continue
+		}
+		L().Infof("resolving %s with %s", link, resolver.Name())
+		client := NewHTTPClientWithOptions(options, link)
+		client.Timeout = resolverTimeout
+		result, err := resolver.Resolve(client, u)
+		return result, resolver, err
+	}
+	return nil, nil, ErrNotResolvable
+}
+
+// ResolveNative : the resolver is nil when no native resolver matched the link
+func ResolveNative(link string, options *HTTPRequestOptions) (*ExtractResult, Resolver, error) {
+	return resolveWith(nativeResolvers, link, options)
+}
+
+func ResolveFallback(link string, options *HTTPRequestOptions) (*ExtractResult, Resolver, error) {
+	return resolveWith(fallbackResolvers, link, options)
+}
+
+func GetResolversInfoString() string {
+	out := ""
+	for _, resolver := range GetResolvers() {
+		out += fmt.Sprintf("<code>%s</code>: %s\n", resolver.Name(), resolver.Description())
+	}
+	return out
+}
+
+// resolverGet : the client's transport sets the user agent
+func resolverGet(client *http.Client, link string, accept string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", res.Request.URL.Host, res.Status)
+	}
+	return res, nil
+}
+
+// resolverIsHtml : asks with a HEAD request first so links to files are never downloaded by the page resolver
+func resolverIsHtml(client *http.Client, link string) bool {
+	req, err := http.NewRequest(http.MethodHead, link, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	res, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	res.Body.Close()
+	return res.StatusCode < 400 && strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "text/html")
+}
+
+// DropboxResolver : share links serve a preview page unless dl=1 is set
+type DropboxResolver struct{}
+
+func (r *DropboxResolver) Name() string {
+	return "dropbox"
+}
+
+func (r *DropboxResolver) Description() string {
+	return "Dropbox share links rewritten to direct downloads"
+}
+
+func (r *DropboxResolver) Match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if host != "dropbox.com" && host != "www.dropbox.com" {
+		return false
+	}
+	return strings.HasPrefix(u.Path, "/s/") || strings.HasPrefix(u.Path, "/sh/") || strings.HasPrefix(u.Path, "/scl/fi/")
+}
+
+func (r *DropboxResolver) Resolve(client *http.Client, u *url.URL) (*ExtractResult, error) {
+	direct := *u
+	query := direct.Query()
+	query.Del("raw")
+	query.Set("dl", "1")
+	direct.RawQuery = query.Encode()
+	direct.Fragment = ""
+	return &ExtractResult{Url: direct.String()}, nil
+}
+
+// OneDriveResolver : uses the shares api, which turns any sharing url into a content url
+type OneDriveResolver struct{}
+
+func (r *OneDriveResolver) Name() string {
+	return "onedrive"
+}
+
+func (r *OneDriveResolver) Description() string {
+	return "OneDrive and 1drv.ms share links rewritten to direct downloads"
+}
+
+func (r *OneDriveResolver) Match(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return host == "1drv.ms" || host == "onedrive.live.com"
+}
+
+func (r *OneDriveResolver) Resolve(client *http.Client, u *url.URL) (*ExtractResult, error) {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(u.String()))
+	return &ExtractResult{Url: fmt.Sprintf("https://api.onedrive.com/v1.0/shares/u!%s/root/content", encoded)}, nil
+}
+
+// GitHubReleaseResolver : release pages are resolved through the api, an asset can be picked with #asset-name
+type GitHubReleaseResolver struct{}
+
+type gitHubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name               string `json:"name"`
+		BrowserDownloadUrl string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *GitHubReleaseResolver) Name() string {
+	return "github"
+}
+
+func (r *GitHubReleaseResolver) Description() string {
+	return "GitHub release pages and assets, pick an asset with #asset-name"
+}
+
+func (r *GitHubReleaseResolver) Match(u *url.URL) bool {
+	if strings.ToLower(u.Hostname()) != "github.com" {
+		return false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	return len(parts) >= 3 && parts[2] == "releases"
+}
+
+func (r *GitHubReleaseResolver) Resolve(client *http.Client, u *url.URL) (*ExtractResult, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	owner, repo := parts[0], parts[1]
+	rest := parts[3:]
+	// releases/download/{tag}/{asset} and releases/latest/download/{asset} are already direct
+	if (len(rest) == 3 && rest[0] == "download") || (len(rest) == 3 && rest[0] == "latest" && rest[1] == "download") {
+		return &ExtractResult{Url: u.String(), Filename: path.Base(u.Path)}, nil
+	}
+	var api string
+	switch {
+	case len(rest) == 0 || (len(rest) == 1 && rest[0] == "latest"):
+		api = fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", owner, repo)
+	case len(rest) == 2 && rest[0] == "tag":
+		api = fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/tags/%s", owner, repo, url.PathEscape(rest[1]))
+	default:
+		return nil, ErrNotResolvable
+	}
+	res, err := resolverGet(client, api, "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var release gitHubRelease
+	err = json.NewDecoder(io.LimitReader(res.Body, ResolverMaxPageSize)).Decode(&release)
+	if err != nil {
+		return nil, fmt.Errorf("github: failed to parse release: %v", err)
+	}
+	if len(release.Assets) == 0 {
+		return nil, fmt.Errorf("github: release %s has no assets", release.TagName)
+	}
+	var names []string
+	for _, asset := range release.Assets {
+		if u.Fragment != "" && asset.Name == u.Fragment {
+			return &ExtractResult{Url: asset.BrowserDownloadUrl, Filename: asset.Name}, nil
+		}
+		names = append(names, asset.Name)
+	}
+	if u.Fragment != "" {
+		return nil, fmt.Errorf("github: release %s has no asset %s, available: %s", release.TagName, u.Fragment, strings.Join(names, ", "))
+	}
+	if len(release.Assets) == 1 {
+		return &ExtractResult{Url: release.Assets[0].BrowserDownloadUrl, Filename: release.Assets[0].Name}, nil
+	}
+	return nil, fmt.Errorf("github: release %s has several assets, append #name of one of: %s", release.TagName, strings.Join(names, ", "))
+}
+
+// PageMediaResolver : html pages exposing og:video or a download anchor, anything else is left alone,
+// pages are only fetched once a HEAD request reports text/html
+type PageMediaResolver struct{}
+
+func (r *PageMediaResolver) Name() string {
+	return "page"
+}
+
+func (r *PageMediaResolver) Description() string {
+	return "generic pages exposing og:video or a download link, tried after scripts"
+}
+
+func (r *PageMediaResolver) Match(u *url.URL) bool {
+	link := u.String()
+	if utils.GetFileIdByGDriveLink(link) != "" || utils.IsMegaLink(link) || utils.EndsWithTorrent(u.Path) {
+		return false
+	}
+	return true
+}
+
+func (r *PageMediaResolver) Resolve(client *http.Client, u *url.URL) (*ExtractResult, error) {
+	if !resolverIsHtml(client, u.String()) {
+		return nil, ErrNotResolvable
+	}
+	res, err := resolverGet(client, u.String(), "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if !strings.Contains(strings.ToLower(res.Header.Get("Content-Type")), "text/html") {
+		return nil, ErrNotResolvable
+	}
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(res.Body, ResolverMaxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	var found string
+	for _, property := range []string{"og:video:secure_url", "og:video:url", "og:video"} {
+		content, ok := doc.Find(fmt.Sprintf(`meta[property="%s"]`, property)).First().Attr("content")
+		if ok && strings.TrimSpace(content) != "" {
+			found = strings.TrimSpace(content)
+			break
+		}
+	}
+	if found == "" {
+		href, ok := doc.Find("a[download][href]").First().Attr("href")
+		if ok && strings.TrimSpace(href) != "" {
+			found = strings.TrimSpace(href)
+		}
+	}
+	if found == "" {
+		return nil, ErrNotResolvable
+	}
+	// relative to the final url, the page may have been reached through redirects
+	direct, err := res.Request.URL.Parse(found)
+	if err != nil {
+		return nil, err
+	}
+	if direct.Scheme != "http" && direct.Scheme != "https" {
+		return nil, ErrNotResolvable
+	}
+	return &ExtractResult{Url: direct.String()}, nil
+}
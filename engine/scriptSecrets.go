@@ -0,0 +1,46 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// secretDeclarationRegex : scripts declare the secrets they need with "// @secrets KEY_A, KEY_B" lines
+var secretDeclarationRegex = regexp.MustCompile(`(?m)^\s*//\s*@secrets?\s+(.+)$`)
+
+func GetDeclaredSecrets(script string) []string {
+	seen := make(map[string]bool)
+	var declared []string
+	for _, match := range secretDeclarationRegex.FindAllStringSubmatch(script, -1) {
+		for _, key := range strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' }) {
+			key = strings.TrimSpace(key)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			declared = append(declared, key)
+		}
+	}
+	return declared
+}
+
+// ScopeSecrets : only the declared secrets are handed to the runtime, undeclared ones stay invisible to the script
+func ScopeSecrets(script string, secrets map[string]string) (map[string]string, error) {
+	scoped := make(map[string]string)
+	var missing []string
+	for _, key := range GetDeclaredSecrets(script) {
+		value, ok := secrets[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		scoped[key] = value
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("script declares secrets that are not set: %s", strings.Join(missing, ", "))
+	}
+	return scoped, nil
+}
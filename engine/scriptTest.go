@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"MirrorBotGo/httpreplay"
+	"MirrorBotGo/utils"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ScriptFixture : one recorded request/response pair replayed to an extractor script
+type ScriptFixture = httpreplay.Fixture
+
+// maxScriptTestFixturesSize : test cases are stored one per document, which mongo caps at 16MB
+const maxScriptTestFixturesSize = 12 * 1024 * 1024
+
+// ScriptTestCase : stored one per document next to the extractor, expected is the exact value extract() has to return
+type ScriptTestCase struct {
+	Name     string          `bson:"name" json:"name"`
+	Link     string          `bson:"link" json:"link"`
+	Expected string          `bson:"expected" json:"expected"`
+	Fixtures []ScriptFixture `bson:"fixtures" json:"fixtures"`
+}
+
+type ScriptTestResult struct {
+	Name     string
+	Passed   bool
+	Got      string
+	Expected string
+	Err      error
+	Duration time.Duration
+}
+
+// RunScriptTest : runs the extractor against the recorded fixtures of the test case
+func RunScriptTest(script string, secrets map[string]string, testCase ScriptTestCase, b *gotgbot.Bot, ctx *ext.Context) *ScriptTestResult {
+	sandbox := NewJSSandbox(GetDefaultJSSandboxLimits())
+	sandbox.SetTransport(httpreplay.NewReplayTransport(testCase.Fixtures))
+	start := time.Now()
+	got := ""
+	extracted, err := extractDDLJSWithSandbox(testCase.Link, script, secrets, b, ctx, sandbox)
+	if err == nil {
+		got = extracted.String()
+	}
+	result := &ScriptTestResult{
+		Name:     testCase.Name,
+		Got:      got,
+		Expected: testCase.Expected,
+		Err:      err,
+		Duration: time.Now().Sub(start),
+	}
+	result.Passed = err == nil && got == testCase.Expected
+	return result
+}
+
+// RecordScriptTest : runs the extractor live and turns the requests and the result into a test case
+func RecordScriptTest(name string, link string, script string, secrets map[string]string, b *gotgbot.Bot, ctx *ext.Context) (*ScriptTestCase, error) {
+	limits := GetDefaultJSSandboxLimits()
+	sandbox := NewJSSandbox(limits)
+	recorder := httpreplay.NewRecordingTransport(sandbox.GetTransport(), limits.MaxResponseSize)
+	sandbox.SetTransport(recorder)
+	extracted, err := extractDDLJSWithSandbox(link, script, secrets, b, ctx, sandbox)
+	if err != nil {
+		return nil, err
+	}
+	fixtures := recorder.GetFixtures()
+	if size := httpreplay.GetFixturesSize(fixtures); size > maxScriptTestFixturesSize {
+		return nil, fmt.Errorf("the recorded responses add up to %s, test cases are limited to %s", utils.GetHumanBytes(size), utils.GetHumanBytes(maxScriptTestFixturesSize))
+	}
+	return &ScriptTestCase{
+		Name:     name,
+		Link:     link,
+		Expected: extracted.String(),
+		Fixtures: fixtures,
+	}, nil
+}
+
+func GetScriptTestReport(regex string, results []*ScriptTestResult) string {
+	passed := 0
+	out := ""
+	for _, result := range results {
+		if result.Passed {
+			passed++
+			out += fmt.Sprintf("✅ <code>%s</code> (%s)\n", html.EscapeString(result.Name), result.Duration.Round(time.Millisecond))
+			continue
+		}
+		out += fmt.Sprintf("❌ <code>%s</code> (%s)\n", html.EscapeString(result.Name), result.Duration.Round(time.Millisecond))
+		if result.Err != nil {
+			out += fmt.Sprintf("   error: <code>%s</code>\n", html.EscapeString(result.Err.Error()))
+		} else {
+			out += fmt.Sprintf("   expected: <code>%s</code>\n", html.EscapeString(result.Expected))
+			out += fmt.Sprintf("   got: <code>%s</code>\n", html.EscapeString(result.Got))
+		}
+	}
+	return fmt.Sprintf("Tests for <code>%s</code>: %d/%d passed\n\n", html.EscapeString(regex), passed, len(results)) + out
+}
@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SeedPolicy : decides when a seeding torrent has seeded enough and can be dropped
+type SeedPolicy struct {
+	RatioLimit float64       // 0 means no ratio limit
+	TimeLimit  time.Duration // 0 means no seed time limit
+	MinTime    time.Duration // never stop seeding before this
+}
+
+// SeedingStatus : implemented by the torrent statuses which enforce a seed policy
+type SeedingStatus interface {
+	GetSeedRatio() float64
+	GetSeedPolicy() *SeedPolicy
+	GetSeedTimeRemaining() *time.Duration
+}
+
+func GetSeedingStatusString(seeder SeedingStatus) string {
+	policy := seeder.GetSeedPolicy()
+	out := fmt.Sprintf("\nR: %.2f", seeder.GetSeedRatio())
+	if policy.RatioLimit > 0 {
+		out += fmt.Sprintf("/%.2f", policy.RatioLimit)
+	}
+	remaining := seeder.GetSeedTimeRemaining()
+	if remaining != nil {
+		out += fmt.Sprintf(" | RST: %s", utils.HumanizeDuration(*remaining))
+	} else {
+		out += " | RST: ∞"
+	}
+	return out
+}
+
+func NewDefaultSeedPolicy() *SeedPolicy {
+	return &SeedPolicy{
+		RatioLimit: utils.GetSeedRatioLimit(),
+		TimeLimit:  utils.GetSeedTimeLimit(),
+		MinTime:    utils.GetSeedMinTime(),
+	}
+}
+
+// NewSeedPolicyFromOptions : global policy overridden by the per task --ratio, --seedtime and --minseedtime options
+func NewSeedPolicyFromOptions(options map[string]string) (*SeedPolicy, error) {
+	policy := NewDefaultSeedPolicy()
+	if val, ok := options["ratio"]; ok {
+		ratio, err := strconv.ParseFloat(val, 64)
+		if err != nil || ratio < 0 {
+			return nil, fmt.Errorf("invalid seed ratio: %s", val)
+		}
+		policy.RatioLimit = ratio
+	}
+	if val, ok := options["seedtime"]; ok {
+		dur, err := parseSeedDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed time: %s", val)
+		}
+		policy.TimeLimit = dur
+	}
+	if val, ok := options["minseedtime"]; ok {
+		dur, err := parseSeedDuration(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid minimum seed time: %s", val)
+		}
+		policy.MinTime = dur
+	}
+	return policy, nil
+}
+
+// parseSeedDuration : accepts go durations (90m, 2h) or plain minutes
+func parseSeedDuration(val string) (time.Duration, error) {
+	minutes, err := strconv.Atoi(val)
+	if err == nil {
+		if minutes < 0 {
+			return 0, fmt.Errorf("negative duration")
+		}
+		return time.Duration(minutes) * time.Minute, nil
+	}
+	dur, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, err
+	}
+	if dur < 0 {
+		return 0, fmt.Errorf("negative duration")
+	}
+	return dur, nil
+}
+
+func (p *SeedPolicy) IsLimited() bool {
+	return p.RatioLimit > 0 || p.TimeLimit > 0
+}
+
+func (p *SeedPolicy) IsReached(ratio float64, seedTime time.Duration) bool {
+	if !p.IsLimited() || seedTime < p.MinTime {
+		return false
+	}
+	if p.RatioLimit > 0 && ratio >= p.RatioLimit {
+		return true
+	}
+	if p.TimeLimit > 0 && seedTime >= p.TimeLimit {
+		return true
+	}
+	return false
+}
+
+// RemainingTime : seed time left before the time limit is reached, nil if there is no time limit
+func (p *SeedPolicy) RemainingTime(seedTime time.Duration) *time.Duration {
+	if p.TimeLimit == 0 {
+		return nil
+	}
+	limit := p.TimeLimit
+	if limit < p.MinTime {
+		limit = p.MinTime
+	}
+	remaining := limit - seedTime
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+func (p *SeedPolicy) String() string {
+	ratio := "∞"
+	if p.RatioLimit > 0 {
+		ratio = fmt.Sprintf("%.2f", p.RatioLimit)
+	}
+	seedTime := "∞"
+	if p.TimeLimit > 0 {
+		seedTime = utils.HumanizeDuration(p.TimeLimit)
+	}
+	return fmt.Sprintf("Ratio: %s, SeedTime: %s, MinSeedTime: %s", ratio, seedTime, utils.HumanizeDuration(p.MinTime))
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	StatusFilterAll  = "all"
+	StatusFilterChat = "chat"
+	StatusFilterUser = "user"
+)
+
+const (
+	StatusSortIndex    = "index"
+	StatusSortName     = "name"
+	StatusSortProgress = "progress"
+	StatusSortSpeed    = "speed"
+)
+
+var statusSortOrder []string = []string{StatusSortIndex, StatusSortName, StatusSortProgress, StatusSortSpeed}
+
+var StatusViewStorage map[int64]*StatusView = make(map[int64]*StatusView) // chatId : view
+var statusViewMutex sync.Mutex
+
+// StatusView : per chat state of the status message, the page being shown and which mirrors are shown in what order
+type StatusView struct {
+	ChatId int64
+	UserId int64 // user whose mirrors are shown when Filter is StatusFilterUser, only set in private chats
+	Page   int
+	Filter string
+	Sort   string
+}
+
+func NewStatusView(chatId int64, userId int64) *StatusView {
+	return &StatusView{
+		ChatId: chatId,
+		UserId: userId,
+		Page:   0,
+		Filter: StatusFilterAll,
+		Sort:   StatusSortIndex,
+	}
+}
+
+func GetStatusView(chatId int64) *StatusView {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	view, ok := StatusViewStorage[chatId]
+	if !ok {
+		var userId int64
+		if chatId > 0 {
+			userId = chatId
+		}
+		view = NewStatusView(chatId, userId)
+		StatusViewStorage[chatId] = view
+	}
+	return view
+}
+
+func DeleteStatusViewByChatId(chatId int64) {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	delete(StatusViewStorage, chatId)
+}
+
+// isPrivate : private chats have the id of the user, groups and channels have negative ids
+func (v *StatusView) isPrivate() bool {
+	return v.ChatId > 0
+}
+
+// SetFilter : the status message of a group is shared by everyone in it, so only private chats can show just their user's mirrors
+func (v *StatusView) SetFilter(filter string, userId int64) {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	if filter == StatusFilterUser && !v.isPrivate() {
+		return
+	}
+	v.Filter = filter
+	if filter == StatusFilterUser {
+		v.UserId = userId
+	}
+	v.Page = 0
+}
+
+// NextSort : cycles through the available sort orders
+func (v *StatusView) NextSort() {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	next := 0
+	for i, s := range statusSortOrder {
+		if s == v.Sort {
+			next = (i + 1) % len(statusSortOrder)
+			break
+		}
+	}
+	v.Sort = statusSortOrder[next]
+	v.Page = 0
+}
+
+func (v *StatusView) SetPage(page int) {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	if page < 0 {
+		page = 0
+	}
+	v.Page = page
+}
+
+func (v *StatusView) GetPage() int {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	return v.Page
+}
+
+// getFilterAndSort : the status updater reads these while callbacks change them
+func (v *StatusView) getFilterAndSort() (string, int64, string) {
+	statusViewMutex.Lock()
+	defer statusViewMutex.Unlock()
+	return v.Filter, v.UserId, v.Sort
+}
+
+func (v *StatusView) isMirrorVisible(dl MirrorStatus, filter string, userId int64) bool {
+	switch filter {
+	case StatusFilterChat:
+		msg := GetMirrorMessage(dl)
+		return msg != nil && msg.Chat.Id == v.ChatId
+	case StatusFilterUser:
+		msg := GetMirrorMessage(dl)
+		return msg != nil && msg.From != nil && msg.From.Id == userId
+	default:
+		return true
+	}
+}
+
+// GetMirrors : returns the mirrors visible in this view, sorted by the view's sort order
+func (v *StatusView) GetMirrors() []MirrorStatus {
+	filter, userId, sortBy := v.getFilterAndSort()
+	var dls []MirrorStatus
+	for _, dl := range GetAllMirrors() {
+		if v.isMirrorVisible(dl, filter, userId) {
+			dls = append(dls, dl)
+		}
+	}
+	switch sortBy {
+	case StatusSortName:
+		sort.SliceStable(dls, func(i, j int) bool {
+			return strings.ToLower(dls[i].Name()) < strings.ToLower(dls[j].Name())
+		})
+	case StatusSortProgress:
+		sort.SliceStable(dls, func(i, j int) bool {
+			return dls[i].Percentage() > dls[j].Percentage()
+		})
+	case StatusSortSpeed:
+		sort.SliceStable(dls, func(i, j int) bool {
+			return dls[i].Speed() > dls[j].Speed()
+		})
+	}
+	return dls
+}
+
+func (v *StatusView) GetMirrorsChunked(chunkSize int) [][]MirrorStatus {
+	return ChunkMirrors(v.GetMirrors(), chunkSize)
+}
+
+func filterButtonText(current string, filter string, text string) string {
+	if current == filter {
+		return "✓ " + text
+	}
+	return text
+}
+
+func GetStatusViewMarkup(view *StatusView, previous bool, next bool, prString string, nxString string) gotgbot.InlineKeyboardMarkup {
+	markup := GetPaginationMarkup(previous, next, prString, nxString)
+	if len(markup.InlineKeyboard) > 0 && len(markup.InlineKeyboard[0]) == 0 {
+		markup.InlineKeyboard = markup.InlineKeyboard[1:]
+	}
+	filter, _, sortBy := view.getFilterAndSort()
+	filterButtons := []gotgbot.InlineKeyboardButton{
+		NewKeyboardButtonText(filterButtonText(filter, StatusFilterAll, "All"), "status_filter_all"),
+		NewKeyboardButtonText(filterButtonText(filter, StatusFilterChat, "This chat"), "status_filter_chat"),
+	}
+	if view.isPrivate() {
+		filterButtons = append(filterButtons, NewKeyboardButtonText(filterButtonText(filter, StatusFilterUser, "Mine"), "status_filter_user"))
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, filterButtons, []gotgbot.InlineKeyboardButton{
+		NewKeyboardButtonText("Sort: "+sortBy, "status_sort"),
+	})
+	return markup
+}
@@ -3,29 +3,94 @@ package engine
 import (
 	"MirrorBotGo/utils"
 	"context"
-	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"net/url"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/gotd/contrib/bg"
 	"github.com/gotd/td/session"
 	"github.com/gotd/td/telegram"
-	"github.com/gotd/td/telegram/downloader"
 	"github.com/gotd/td/tg"
 )
 
-var gotdClient *telegram.Client = getTgClient()
 var gotdDownloader *GotdDownloader = getGotdDownloader()
-var gotdDownloadThreads int = 4
 
-var accessHashesCache map[int64]int64 = make(map[int64]int64)
+// gotdDownloadThreads : 0 picks the thread count of each download automatically
+var gotdDownloadThreads int = 0
+
+var gotdBotSession *GotdSession = getTgBotSession()
+var telegramBackend *Backend = NewBackend("Telegram MTProto", func(ctx context.Context) (string, error) {
+	return gotdBotSession.Check(ctx)
+}, nil, nil)
+
+const (
+	TelegramMaxAlbumSize          = 10
+	TelegramMaxMessagesPerRequest = 100
+	// TelegramMaxRangeMessages : upper bound for t.me/<channel>/<from>-<to> links
+	TelegramMaxRangeMessages = 500
+)
+
+// telegramMessageLinkRegex : t.me/<channel>/<id>, t.me/s/<channel>/<id> and t.me/c/<chat>/<id>, with an optional topic id
+// before the message id and an optional -<to> for ranges
+var telegramMessageLinkRegex = regexp.MustCompile(`^(?:https?://)?(?:www\.)?(?:t|telegram)\.me/(?:c/(\d+)|(?:s/)?([A-Za-z][A-Za-z0-9_]{3,31}))/(?:\d+/)?(\d+)(?:-(\d+))?/?(\?.*)?$`)
+
+// TelegramMessageLink : either Username or ChatID is set, From equals To for links to a single message
+type TelegramMessageLink struct {
+	Username string
+	ChatID   int64
+	From     int
+	To       int
+	Single   bool
+}
+
+func (t *TelegramMessageLink) IsRange() bool {
+	return t.From != t.To
+}
+
+func IsTelegramMessageLink(link string) bool {
+	return telegramMessageLinkRegex.MatchString(link)
+}
+
+// ParseTelegramMessageLink : ?single on a link to an album message keeps telegram's meaning of that message only
+func ParseTelegramMessageLink(link string) (*TelegramMessageLink, error) {
+	match := telegramMessageLinkRegex.FindStringSubmatch(link)
+	if match == nil {
+		return nil, fmt.Errorf("not a message link, expected t.me/<channel>/<id>, t.me/c/<chat>/<id> or a <from>-<to> range")
+	}
+	from, _ := strconv.Atoi(match[3])
+	to := from
+	if match[4] != "" {
+		to, _ = strconv.Atoi(match[4])
+	}
+	if from <= 0 || to < from {
+		return nil, fmt.Errorf("invalid message range %d-%d", from, to)
+	}
+	if to-from+1 > TelegramMaxRangeMessages {
+		return nil, fmt.Errorf("message range %d-%d is larger than %d messages", from, to, TelegramMaxRangeMessages)
+	}
+	out := &TelegramMessageLink{Username: match[2], From: from, To: to}
+	if match[1] != "" {
+		out.ChatID = utils.ParseStringToInt64(match[1])
+	}
+	if match[5] != "" {
+		query, err := url.ParseQuery(strings.TrimPrefix(match[5], "?"))
+		if err == nil {
+			_, out.Single = query["single"]
+		}
+	}
+	return out, nil
+}
 
 func GetGotdDownloadThreadsCount() int {
 	return gotdDownloadThreads
@@ -48,24 +113,11 @@ func GetChatIdFromPeerClass(c tg.PeerClass) int64 {
 	}
 }
 
-func GetAccessHashByChatID(chatID int64) int64 {
-	for i, j := range accessHashesCache {
-		if i == chatID {
-			return j
-		}
-	}
-	return -1
-}
-
-func AddAccessHashCache(chatID int64, accessHash int64) {
-	accessHashesCache[chatID] = accessHash
-}
-
 func getGotdDownloader() *GotdDownloader {
 	return &GotdDownloader{}
 }
 
-func getTgClient() *telegram.Client {
+func getTgBotSession() *GotdSession {
 	appIDInt, err := strconv.Atoi(utils.GetTgAppId())
 	if err != nil {
 		L().Fatal(err)
@@ -77,12 +129,13 @@ func getTgClient() *telegram.Client {
 		SessionStorage: &session.FileStorage{Path: "file.session"},
 	}
 	client := telegram.NewClient(appIDInt, utils.GetTgAppHash(), opts)
+	botSession := NewGotdSession("bot", client)
 	dispatcher.OnNewChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewChannelMessage) error {
 		for _, channel := range e.Channels {
-			AddAccessHashCache(channel.ID, channel.AccessHash)
+			botSession.AddAccessHash(channel.ID, channel.AccessHash)
 		}
 		for _, user := range e.Users {
-			AddAccessHashCache(user.ID, user.AccessHash)
+			botSession.AddAccessHash(user.ID, user.AccessHash)
 		}
 		return nil
 	})
@@ -103,32 +156,48 @@ func getTgClient() *telegram.Client {
 				log.Fatal(err)
 			}
 		}
+		botSession.SetReady()
 	}()
-	return client
+	return botSession
 }
 
-func NewGotdDownloadListener(document *tg.Document, filename string, filePath string, listener *MirrorListener, prg *GotdProgressWriter) *GotdDownloadListener {
+// gotdFile : one file of a telegram download, albums and message ranges have several, the message is kept to refresh the
+// file reference and key names the partial file downloads resume from
+type gotdFile struct {
+	location  tg.InputFileLocationClass
+	size      int64
+	key       string
+	messageID int
+	peer      tg.PeerClass
+	filename  string
+	filePath  string
+}
+
+func NewGotdDownloadListener(files []*gotdFile, name string, filePath string, listener *MirrorListener, prg *GotdProgressWriter, cancel context.CancelFunc) *GotdDownloadListener {
 	return &GotdDownloadListener{
-		document: document,
-		filename: filename,
+		files:    files,
+		name:     name,
 		filePath: filePath,
 		listener: listener,
 		prg:      prg,
+		cancel:   cancel,
 	}
 }
 
+// GotdDownloadListener : filePath is the file itself for a single document and the task directory otherwise
 type GotdDownloadListener struct {
-	document               *tg.Document
-	filename               string
+	files                  []*gotdFile
+	name                   string
 	filePath               string
 	listener               *MirrorListener
 	prg                    *GotdProgressWriter
+	cancel                 context.CancelFunc
 	speed                  int64
 	isSpeedObserverRunning bool
 }
 
 func (g *GotdDownloadListener) GetCompleted() int64 {
-	return g.prg.completed
+	return atomic.LoadInt64(&g.prg.completed)
 }
 
 func (g *GotdDownloadListener) GetTotal() int64 {
@@ -140,15 +209,17 @@ func (g *GotdDownloadListener) GetSpeed() int64 {
 }
 
 func (g *GotdDownloadListener) IsCancelled() bool {
-	return g.prg.isCancelled
+	return g.prg.IsCancelled()
 }
 
+// Cancel : cancelling the context also ends flood waits, retry backoffs and part requests in flight
 func (g *GotdDownloadListener) Cancel() {
 	g.prg.Cancel()
+	g.cancel()
 }
 
 func (g *GotdDownloadListener) OnDownloadStart() {
-	L().Infof("[GotdDownload] %s | %d -> %s", g.filename, g.document.Size, g.filePath)
+	L().Infof("[GotdDownload] %s | %d files | %d -> %s", g.name, len(g.files), g.prg.total, g.filePath)
 	g.StartSpeedObserver()
 }
 
@@ -158,7 +229,7 @@ func (g *GotdDownloadListener) OnDownloadComplete() {
 }
 
 func (g *GotdDownloadListener) OnDownloadStop(err error) {
-	g.StartSpeedObserver()
+	g.StopSpeedObserver()
 	g.listener.OnDownloadError(err.Error())
 }
 
@@ -224,66 +295,119 @@ func (g *GotdDownloader) GetDocumentFilename(document *tg.Document) string {
 	return ""
 }
 
-func (g *GotdDownloader) Download(ctx context.Context, api *tg.Client, document *tg.Document, writer io.WriterAt) chan error {
-	d := downloader.NewDownloader()
+// Download : files are fetched one after another, each one with its own number of parallel part requests
+func (g *GotdDownloader) Download(ctx context.Context, gotdSession *GotdSession, files []*gotdFile, prg *GotdProgressWriter) chan error {
 	errorChannel := make(chan error)
 	go func() {
-		_, err := d.Download(api, document.AsInputDocumentFileLocation()).WithThreads(gotdDownloadThreads).Parallel(ctx, writer)
-		if err != nil {
-			errorChannel <- err
+		defer close(errorChannel)
+		for i, file := range files {
+			err := g.downloadFile(ctx, gotdSession, file, i, prg)
+			if err != nil {
+				errorChannel <- err
+				return
+			}
 		}
-		close(errorChannel)
 	}()
 	return errorChannel
 }
 
-func (g *GotdDownloader) GetMessageAPI(ctx context.Context, api *tg.Client, messageID int, channelID int64, isPrivate bool) (*tg.Message, error) {
-	var messages tg.MessagesMessagesClass
-	var err error
-
-	inputMessageId := tg.InputMessageID{ID: messageID}
-	if isPrivate {
-		messages, err = api.MessagesGetMessages(ctx, []tg.InputMessageClass{&inputMessageId})
-	} else {
-		chatIdStr := utils.ParseInt64ToString(channelID)
-		if strings.HasPrefix(chatIdStr, "-100") {
-			chatIdStr = string(chatIdStr[4:])
+// GetMessagesAPI : ids that do not exist or are service messages are left out of the result
+func (g *GotdDownloader) GetMessagesAPI(ctx context.Context, gotdSession *GotdSession, messageIDs []int, channelID int64, isPrivate bool) ([]*tg.Message, error) {
+	var out []*tg.Message
+	for start := 0; start < len(messageIDs); start += TelegramMaxMessagesPerRequest {
+		end := start + TelegramMaxMessagesPerRequest
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		var inputMessageIds []tg.InputMessageClass
+		for _, id := range messageIDs[start:end] {
+			inputMessageIds = append(inputMessageIds, &tg.InputMessageID{ID: id})
+		}
+		api := gotdSession.API()
+		var messages tg.MessagesMessagesClass
+		var err error
+		if isPrivate {
+			messages, err = api.MessagesGetMessages(ctx, inputMessageIds)
+		} else {
+			chatIdStr := utils.ParseInt64ToString(channelID)
+			if strings.HasPrefix(chatIdStr, "-100") {
+				chatIdStr = string(chatIdStr[4:])
+			}
+			channelID = utils.ParseStringToInt64(chatIdStr)
+			accessHash := gotdSession.GetAccessHash(channelID)
+			messages, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+				Channel: &tg.InputChannel{
+					ChannelID:  channelID,
+					AccessHash: accessHash,
+				},
+				ID: inputMessageIds,
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+		messes, err := g.GetMessageClassArray(messages)
+		if err != nil {
+			return nil, err
+		}
+		for _, messageClass := range messes {
+			m, ok := messageClass.(*tg.Message)
+			if ok {
+				out = append(out, m)
+			}
 		}
-		channelID = utils.ParseStringToInt64(chatIdStr)
-		accessHash := GetAccessHashByChatID(channelID)
-		messages, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
-			Channel: &tg.InputChannel{
-				ChannelID:  channelID,
-				AccessHash: accessHash,
-			},
-			ID: []tg.InputMessageClass{&inputMessageId},
-		})
-
-	}
-	if err != nil {
-		return nil, err
 	}
-	messes, err := g.GetMessageClassArray(messages)
+	return out, nil
+}
+
+func (g *GotdDownloader) GetMessageAPI(ctx context.Context, gotdSession *GotdSession, messageID int, channelID int64, isPrivate bool) (*tg.Message, error) {
+	messages, err := g.GetMessagesAPI(ctx, gotdSession, []int{messageID}, channelID, isPrivate)
 	if err != nil {
 		return nil, err
 	}
-	if len(messes) == 0 {
+	if len(messages) == 0 {
 		return nil, fmt.Errorf("Failed to fetch message")
 	}
-	messageClass := messes[0]
-	m, ok := messageClass.(*tg.Message)
-	if !ok {
-		return nil, fmt.Errorf("document parsing failed")
+	return messages[0], nil
+}
+
+// refetchMessage : bots see private chats and basic groups through messages.getMessages, channels need the channel
+func (g *GotdDownloader) refetchMessage(ctx context.Context, gotdSession *GotdSession, peer tg.PeerClass, messageID int) (*tg.Message, error) {
+	if channel, ok := peer.(*tg.PeerChannel); ok {
+		return g.GetMessageAPI(ctx, gotdSession, messageID, channel.ChannelID, false)
 	}
-	return m, nil
+	return g.GetMessageAPI(ctx, gotdSession, messageID, 0, true)
 }
 
-func (g *GotdDownloader) PrepareDocumentForDownload(ctx context.Context, api *tg.Client, messageId int, chatID int64, isPrivate bool) (*tg.Document, error) {
-	m, err := g.GetMessageAPI(ctx, api, messageId, chatID, isPrivate)
+// GetAlbumMessages : an album holds at most 10 messages with consecutive ids, so all of them are within 9 ids of any member
+func (g *GotdDownloader) GetAlbumMessages(ctx context.Context, gotdSession *GotdSession, m *tg.Message, channelID int64, isPrivate bool) ([]*tg.Message, error) {
+	groupedID, ok := m.GetGroupedID()
+	if !ok {
+		return []*tg.Message{m}, nil
+	}
+	var ids []int
+	for id := m.ID - TelegramMaxAlbumSize + 1; id < m.ID+TelegramMaxAlbumSize; id++ {
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	messages, err := g.GetMessagesAPI(ctx, gotdSession, ids, channelID, isPrivate)
 	if err != nil {
 		return nil, err
 	}
+	var album []*tg.Message
+	for _, message := range messages {
+		if id, ok := message.GetGroupedID(); ok && id == groupedID {
+			album = append(album, message)
+		}
+	}
+	sort.Slice(album, func(i, j int) bool {
+		return album[i].ID < album[j].ID
+	})
+	return album, nil
+}
 
+func (g *GotdDownloader) GetDocumentFromMessage(m *tg.Message) (*tg.Document, error) {
 	doc, err := g.GetMessageDocument(m)
 	if doc == nil {
 		if err != nil {
@@ -298,39 +422,87 @@ func (g *GotdDownloader) PrepareDocumentForDownload(ctx context.Context, api *tg
 	return document, nil
 }
 
-func (g *GotdDownloader) AddDownload(msg *gotgbot.Message, listener *MirrorListener) error {
-	api := tg.NewClient(gotdClient)
-	ctx := context.Background()
-	document, err := g.PrepareDocumentForDownload(ctx, api, int(msg.MessageId), msg.Chat.Id, msg.Chat.Type == "private")
+func (g *GotdDownloader) PrepareDocumentForDownload(ctx context.Context, gotdSession *GotdSession, messageId int, chatID int64, isPrivate bool) (*tg.Document, error) {
+	m, err := g.GetMessageAPI(ctx, gotdSession, messageId, chatID, isPrivate)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	gid := utils.RandString(16)
-	filename := g.GetDocumentFilename(document)
-	if filename == "" {
-		filename = gid
+	return g.GetDocumentFromMessage(m)
+}
+
+// getAlbumName : the album caption if there is one, telegram puts it on a single message of the group
+func getAlbumName(messages []*tg.Message) string {
+	for _, m := range messages {
+		caption := sanitizeFileName(strings.SplitN(m.Message, "\n", 2)[0], "")
+		if caption != "" {
+			return caption
+		}
+	}
+	groupedID, _ := messages[0].GetGroupedID()
+	return fmt.Sprintf("Album %d", groupedID)
+}
+
+// getUniqueFilename : albums often carry several files with the same name
+func getUniqueFilename(filename string, used map[string]bool) string {
+	unique := filename
+	ext := path.Ext(filename)
+	for i := 1; used[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(filename, ext), i, ext)
 	}
+	used[unique] = true
+	return unique
+}
+
+// startDownload : a single message is downloaded as a file, several messages into a directory called name, the files are
+// fetched through the session the messages came from since file references are bound to it
+func (g *GotdDownloader) startDownload(ctx context.Context, gotdSession *GotdSession, messages []*tg.Message, name string, listener *MirrorListener) error {
+	gid := utils.RandString(16)
 	dir := path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(listener.GetUid()))
-	err = os.MkdirAll(dir, 0755)
+	if len(messages) > 1 {
+		dir = path.Join(dir, name)
+	}
+	var files []*gotdFile
+	var total int64
+	used := make(map[string]bool)
+	for _, m := range messages {
+		file, err := g.GetMessageFile(m)
+		if err != nil {
+			if len(messages) == 1 {
+				return err
+			}
+			L().Infof("GotdDownloader: skipping message %d: %v", m.ID, err)
+			continue
+		}
+		file.filename = getUniqueFilename(file.filename, used)
+		file.filePath = path.Join(dir, file.filename)
+		files = append(files, file)
+		total += file.size
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("none of the messages has a file to download")
+	}
+	err := os.MkdirAll(dir, 0755)
 	if err != nil {
 		L().Errorf("GotdDownloader: AddDownload: os.MkdirAll: %s : %v", dir, err)
 		return err
 	}
-	filePath := path.Join(dir, filename)
-	writer, err := os.Create(filePath)
-	if err != nil {
-		return err
+	filePath := dir
+	if len(messages) == 1 {
+		name = files[0].filename
+		filePath = files[0].filePath
 	}
-	prg := NewGotdProgressWriter(writer, int64(document.Size))
-	gotdListener := NewGotdDownloadListener(document, filename, filePath, listener, prg)
+	prg := NewGotdProgressWriter(nil, total)
+	ctx, cancel := context.WithCancel(ctx)
+	gotdListener := NewGotdDownloadListener(files, name, filePath, listener, prg, cancel)
 
 	status := NewGotdDownloadStatus(gotdListener, gid)
 	status.Index_ = GenerateMirrorIndex()
 	AddMirrorLocal(listener.GetUid(), status)
 
-	errChannel := g.Download(ctx, api, document, prg)
+	errChannel := g.Download(ctx, gotdSession, files, prg)
 	status.GetListener().OnDownloadStart(status.Gid())
 	go func() {
+		defer cancel()
 		for err := range errChannel {
 			if err != nil {
 				gotdListener.OnDownloadStop(err)
@@ -343,10 +515,141 @@ func (g *GotdDownloader) AddDownload(msg *gotgbot.Message, listener *MirrorListe
 	return nil
 }
 
+// AddDownload : replying to any message of an album downloads the whole album
+func (g *GotdDownloader) AddDownload(msg *gotgbot.Message, listener *MirrorListener) error {
+	ctx := context.Background()
+	isPrivate := msg.Chat.Type == "private"
+	m, err := g.GetMessageAPI(ctx, gotdBotSession, int(msg.MessageId), msg.Chat.Id, isPrivate)
+	if err != nil {
+		return err
+	}
+	messages, err := g.GetAlbumMessages(ctx, gotdBotSession, m, msg.Chat.Id, isPrivate)
+	if err != nil {
+		return err
+	}
+	name := ""
+	if len(messages) > 1 {
+		name = getAlbumName(messages)
+	}
+	return g.startDownload(ctx, gotdBotSession, messages, name, listener)
+}
+
+// ResolveChannel : returns the channel id of a message link with its access hash cached, the session has to be able to read the channel
+func (g *GotdDownloader) ResolveChannel(ctx context.Context, gotdSession *GotdSession, link *TelegramMessageLink) (int64, error) {
+	api := gotdSession.API()
+	if link.Username == "" {
+		if gotdSession.GetAccessHash(link.ChatID) != -1 {
+			return link.ChatID, nil
+		}
+		if gotdSession == gotdBotSession {
+			// only channels the client has seen have a cached access hash, ask for the channel itself
+			chats, err := api.ChannelsGetChannels(ctx, []tg.InputChannelClass{&tg.InputChannel{ChannelID: link.ChatID}})
+			if err != nil {
+				return 0, fmt.Errorf("cannot access chat %d, the %s has to be a member of it: %v", link.ChatID, gotdSession.Name, err)
+			}
+			gotdSession.CacheChats(chats.GetChats())
+		} else {
+			err := gotdSession.LoadDialogs(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("failed to load the dialogs of the %s session: %v", gotdSession.Name, err)
+			}
+		}
+		if gotdSession.GetAccessHash(link.ChatID) == -1 {
+			return 0, fmt.Errorf("cannot access chat %d, the %s has to be a member of it", link.ChatID, gotdSession.Name)
+		}
+		return link.ChatID, nil
+	}
+	channelID, ok := gotdSession.GetChannelByUsername(link.Username)
+	if ok && gotdSession.GetAccessHash(channelID) != -1 {
+		return channelID, nil
+	}
+	resolved, err := api.ContactsResolveUsername(ctx, link.Username)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve @%s: %v", link.Username, err)
+	}
+	peer, ok := resolved.Peer.(*tg.PeerChannel)
+	if !ok {
+		return 0, fmt.Errorf("@%s is not a channel or a group", link.Username)
+	}
+	gotdSession.CacheChats(resolved.Chats)
+	if gotdSession.GetAccessHash(peer.ChannelID) == -1 {
+		return 0, fmt.Errorf("failed to resolve @%s: no access hash returned", link.Username)
+	}
+	gotdSession.AddChannelUsername(link.Username, peer.ChannelID)
+	return peer.ChannelID, nil
+}
+
+// getLinkMessages : the messages a link points to and the directory name to use when there are several
+func (g *GotdDownloader) getLinkMessages(ctx context.Context, gotdSession *GotdSession, messageLink *TelegramMessageLink) ([]*tg.Message, string, error) {
+	channelID, err := g.ResolveChannel(ctx, gotdSession, messageLink)
+	if err != nil {
+		return nil, "", err
+	}
+	if !messageLink.IsRange() {
+		m, err := g.GetMessageAPI(ctx, gotdSession, messageLink.From, channelID, false)
+		if err != nil {
+			return nil, "", err
+		}
+		messages := []*tg.Message{m}
+		if !messageLink.Single {
+			messages, err = g.GetAlbumMessages(ctx, gotdSession, m, channelID, false)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		name := ""
+		if len(messages) > 1 {
+			name = getAlbumName(messages)
+		}
+		return messages, name, nil
+	}
+	var ids []int
+	for id := messageLink.From; id <= messageLink.To; id++ {
+		ids = append(ids, id)
+	}
+	messages, err := g.GetMessagesAPI(ctx, gotdSession, ids, channelID, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(messages) == 0 {
+		return nil, "", fmt.Errorf("no messages found between %d and %d", messageLink.From, messageLink.To)
+	}
+	return messages, fmt.Sprintf("Messages %d-%d", messageLink.From, messageLink.To), nil
+}
+
+// AddLinkDownload : a link to an album message downloads the album unless it has ?single, every file of a range ends up in one
+// directory and messages without files are skipped, links the bot cannot read are retried with the user session if there is one
+func (g *GotdDownloader) AddLinkDownload(link string, listener *MirrorListener) error {
+	messageLink, err := ParseTelegramMessageLink(link)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	gotdSession := gotdBotSession
+	messages, name, err := g.getLinkMessages(ctx, gotdSession, messageLink)
+	if err != nil {
+		userSession := GetTelegramUserSession()
+		if userSession == nil {
+			return err
+		}
+		L().Infof("GotdDownloader: bot cannot read %s (%v), trying the user session", link, err)
+		gotdSession = userSession
+		messages, name, err = g.getLinkMessages(ctx, gotdSession, messageLink)
+		if err != nil {
+			return err
+		}
+	}
+	return g.startDownload(ctx, gotdSession, messages, name, listener)
+}
+
 func NewTelegramDownload(msg *gotgbot.Message, listener *MirrorListener) error {
 	return gotdDownloader.AddDownload(msg, listener)
 }
 
+func NewTelegramLinkDownload(link string, listener *MirrorListener) error {
+	return gotdDownloader.AddLinkDownload(link, listener)
+}
+
 type GotdDownloadStatus struct {
 	gid          string
 	gotdListener *GotdDownloadListener
@@ -355,7 +658,7 @@ type GotdDownloadStatus struct {
 }
 
 func (g *GotdDownloadStatus) Name() string {
-	return g.gotdListener.filename
+	return g.gotdListener.name
 }
 
 func (g *GotdDownloadStatus) Gid() string {
@@ -438,6 +741,19 @@ func (g *GotdDownloadStatus) CancelMirror() bool {
 	return true
 }
 
+func (g *GotdDownloadStatus) GetDetails() string {
+	prg := g.gotdListener.prg
+	out := fmt.Sprintf("Threads: <code>%d</code>", prg.GetThreads())
+	files := g.gotdListener.files
+	if len(files) < 2 {
+		return out
+	}
+	current := prg.GetCurrentFile()
+	out += fmt.Sprintf("\nFiles: <code>%d/%d</code>\n", current+1, len(files))
+	out += fmt.Sprintf("Current: <code>%s</code>", html.EscapeString(files[current].filename))
+	return out
+}
+
 func NewGotdDownloadStatus(gotdListener *GotdDownloadListener, gid string) *GotdDownloadStatus {
 	return &GotdDownloadStatus{
 		gotdListener: gotdListener,
@@ -445,29 +761,59 @@ func NewGotdDownloadStatus(gotdListener *GotdDownloadListener, gid string) *Gotd
 	}
 }
 
+// GotdProgressWriter : counts the bytes of all files of a download, the writer is swapped for each file
 type GotdProgressWriter struct {
 	writer      io.WriterAt
 	completed   int64
 	total       int64
-	isCancelled bool
+	currentFile int64
+	threads     int64
+	isCancelled int32
 }
 
 func (p *GotdProgressWriter) WriteAt(b []byte, off int64) (int, error) {
-	if p.isCancelled {
-		return 0, errors.New("Canceled by user.")
+	if p.IsCancelled() {
+		return 0, errGotdCanceled
 	}
 	n := len(b)
-	p.completed += int64(n)
 	_, err := p.writer.WriteAt(b, off)
 	if err != nil {
 		L().Errorf("GotdProgressWriter: WriteAt: %d : %v", off, err)
 		return 0, err
 	}
+	atomic.AddInt64(&p.completed, int64(n))
 	return n, nil
 }
 
+func (p *GotdProgressWriter) SetWriter(writer io.WriterAt, index int) {
+	p.writer = writer
+	atomic.StoreInt64(&p.currentFile, int64(index))
+}
+
+func (p *GotdProgressWriter) SetThreads(threads int) {
+	atomic.StoreInt64(&p.threads, int64(threads))
+}
+
+func (p *GotdProgressWriter) GetThreads() int {
+	return int(atomic.LoadInt64(&p.threads))
+}
+
+// AddCompleted : bytes a resumed download already has on disk
+func (p *GotdProgressWriter) AddCompleted(n int64) {
+	atomic.AddInt64(&p.completed, n)
+}
+
+func (p *GotdProgressWriter) GetCurrentFile() int {
+	return int(atomic.LoadInt64(&p.currentFile))
+}
+
+// Cancel : read by every worker of the download
 func (p *GotdProgressWriter) Cancel() {
-	p.isCancelled = true
+	atomic.StoreInt32(&p.isCancelled, 1)
+}
+
+func (p *GotdProgressWriter) IsCancelled() bool {
+	return atomic.LoadInt32(&p.isCancelled) == 1
 }
 
 func NewGotdProgressWriter(writer io.WriterAt, size int64) *GotdProgressWriter {
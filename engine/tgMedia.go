@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// tgMimeExtensions : mime.ExtensionsByType knows few of these and is not stable in the order it returns extensions
+var tgMimeExtensions = map[string]string{
+	"video/mp4":               ".mp4",
+	"video/webm":              ".webm",
+	"video/quicktime":         ".mov",
+	"video/x-matroska":        ".mkv",
+	"audio/ogg":               ".ogg",
+	"audio/mpeg":              ".mp3",
+	"audio/mp4":               ".m4a",
+	"audio/x-m4a":             ".m4a",
+	"audio/flac":              ".flac",
+	"image/jpeg":              ".jpg",
+	"image/png":               ".png",
+	"image/gif":               ".gif",
+	"image/webp":              ".webp",
+	"application/x-tgsticker": ".tgs",
+	"application/pdf":         ".pdf",
+	"application/zip":         ".zip",
+}
+
+func getTgMimeExtension(mimeType string) string {
+	if ext, ok := tgMimeExtensions[mimeType]; ok {
+		return ext
+	}
+	exts, err := mime.ExtensionsByType(mimeType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+// getTgMediaFilename : kind_<message id>_<date><ext>, the message id keeps files of an album apart
+func getTgMediaFilename(kind string, m *tg.Message, ext string) string {
+	date := time.Unix(int64(m.Date), 0).UTC().Format("20060102_150405")
+	return fmt.Sprintf("%s_%d_%s%s", kind, m.ID, date, ext)
+}
+
+// getTgDocumentFilename : used when the document has no file name attribute, which is the case for voice notes, video notes,
+// animations, stickers and most media sent from phones
+func getTgDocumentFilename(m *tg.Message, document *tg.Document) string {
+	ext := getTgMimeExtension(document.MimeType)
+	kind := "file"
+	for _, attr := range document.Attributes {
+		switch a := attr.(type) {
+		case *tg.DocumentAttributeAudio:
+			if a.Voice {
+				return getTgMediaFilename("voice", m, ext)
+			}
+			if a.Title != "" {
+				name := a.Title
+				if a.Performer != "" {
+					name = a.Performer + " - " + a.Title
+				}
+				return sanitizeFileName(name, getTgMediaFilename("audio", m, "")) + ext
+			}
+			kind = "audio"
+		case *tg.DocumentAttributeVideo:
+			if a.RoundMessage {
+				return getTgMediaFilename("video_note", m, ext)
+			}
+			if kind == "file" {
+				kind = "video"
+			}
+		case *tg.DocumentAttributeAnimated:
+			kind = "animation"
+		case *tg.DocumentAttributeSticker:
+			return getTgMediaFilename("sticker", m, ext)
+		}
+	}
+	return getTgMediaFilename(kind, m, ext)
+}
+
+// getLargestPhotoSize : progressive sizes list the byte offsets of each pass, the last one is the full size
+func getLargestPhotoSize(photo *tg.Photo) (string, int64) {
+	var sizeType string
+	var largest int64
+	for _, size := range photo.Sizes {
+		var bytes int64
+		switch s := size.(type) {
+		case *tg.PhotoSize:
+			bytes = int64(s.Size)
+		case *tg.PhotoSizeProgressive:
+			for _, pass := range s.Sizes {
+				if int64(pass) > bytes {
+					bytes = int64(pass)
+				}
+			}
+		default:
+			// stripped and cached sizes are inline thumbnails
+			continue
+		}
+		if bytes > largest {
+			largest = bytes
+			sizeType = size.GetType()
+		}
+	}
+	return sizeType, largest
+}
+
+// GetMessageFile : documents, including voice notes, video notes, animations and stickers, and photos in their largest size
+func (g *GotdDownloader) GetMessageFile(m *tg.Message) (*gotdFile, error) {
+	media, ok := m.GetMedia()
+	if !ok {
+		return nil, fmt.Errorf("message has no media")
+	}
+	switch media := media.(type) {
+	case *tg.MessageMediaDocument:
+		document, ok := media.Document.AsNotEmpty()
+		if !ok {
+			return nil, fmt.Errorf("document parsing failed")
+		}
+		filename := sanitizeFileName(g.GetDocumentFilename(document), "")
+		if filename == "" {
+			filename = getTgDocumentFilename(m, document)
+		}
+		return &gotdFile{
+			location:  document.AsInputDocumentFileLocation(),
+			size:      document.Size,
+			key:       fmt.Sprintf("document_%d", document.ID),
+			messageID: m.ID,
+			peer:      m.PeerID,
+			filename:  filename,
+		}, nil
+	case *tg.MessageMediaPhoto:
+		photo, ok := media.Photo.(*tg.Photo)
+		if !ok {
+			return nil, fmt.Errorf("photo parsing failed")
+		}
+		sizeType, size := getLargestPhotoSize(photo)
+		if sizeType == "" {
+			return nil, fmt.Errorf("photo has no downloadable size")
+		}
+		return &gotdFile{
+			location: &tg.InputPhotoFileLocation{
+				ID:            photo.ID,
+				AccessHash:    photo.AccessHash,
+				FileReference: photo.FileReference,
+				ThumbSize:     sizeType,
+			},
+			size:      size,
+			key:       fmt.Sprintf("photo_%d_%s", photo.ID, sizeType),
+			messageID: m.ID,
+			peer:      m.PeerID,
+			filename:  getTgMediaFilename("photo", m, ".jpg"),
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported media: %s", strings.TrimPrefix(fmt.Sprintf("%T", media), "*tg."))
+}
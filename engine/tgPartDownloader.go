@@ -0,0 +1,443 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+const (
+	// gotdPartSize : offsets and limits of upload.getFile have to divide 1MB
+	gotdPartSize           = 512 * 1024
+	gotdPartRetries        = 5
+	gotdMaxFloodWait       = 5 * time.Minute
+	gotdStateInterval      = time.Second
+	gotdPartialSweepPeriod = time.Hour
+)
+
+var errGotdCanceled = errors.New("Canceled by user.")
+
+// gotdPartials : partial files in use, two tasks downloading the same file must not share one
+var gotdPartials = make(map[string]bool)
+var gotdPartialsMut sync.Mutex
+var gotdKeepPartials bool
+var gotdPartialSweeperOnce sync.Once
+
+// gotdPartialState : stored next to the partial file, every byte below Offset is on disk
+type gotdPartialState struct {
+	Size   int64 `json:"size"`
+	Offset int64 `json:"offset"`
+}
+
+// acquireGotdPartial : partial files live outside the task directory so that a failed or restarted task finds them again,
+// a file that is already being downloaded gets a throwaway partial
+func acquireGotdPartial(key string) string {
+	gotdPartialsMut.Lock()
+	defer gotdPartialsMut.Unlock()
+	if gotdPartials[key] {
+		key = key + "_" + utils.RandString(8)
+	}
+	gotdPartials[key] = true
+	return key
+}
+
+func releaseGotdPartial(key string) {
+	gotdPartialsMut.Lock()
+	defer gotdPartialsMut.Unlock()
+	delete(gotdPartials, key)
+}
+
+func getGotdPartialPath(key string) string {
+	return path.Join(utils.GetTgPartialDir(), key+".part")
+}
+
+// KeepTelegramPartials : called on exit before the mirrors are cancelled, interrupted downloads resume after the restart
+func KeepTelegramPartials() {
+	gotdPartialsMut.Lock()
+	defer gotdPartialsMut.Unlock()
+	gotdKeepPartials = true
+}
+
+func isKeepingGotdPartials() bool {
+	gotdPartialsMut.Lock()
+	defer gotdPartialsMut.Unlock()
+	return gotdKeepPartials
+}
+
+// SweepTelegramPartials : removes partials of downloads that were never retried, files in use are left alone
+func SweepTelegramPartials() {
+	dir := utils.GetTgPartialDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			L().Warnf("GotdDownloader: failed to read %s: %v", dir, err)
+		}
+		return
+	}
+	maxAge := utils.GetTgPartialMaxAge()
+	for _, entry := range entries {
+		name := entry.Name()
+		key := strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".part")
+		if entry.IsDir() || key == name {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		gotdPartialsMut.Lock()
+		inUse := gotdPartials[key]
+		if !inUse {
+			os.Remove(path.Join(dir, name))
+		}
+		gotdPartialsMut.Unlock()
+		if !inUse {
+			L().Infof("GotdDownloader: removed stale partial %s", name)
+		}
+	}
+}
+
+// StartTelegramPartialSweeper : sweeps right away and then every hour
+func StartTelegramPartialSweeper() {
+	gotdPartialSweeperOnce.Do(func() {
+		go func() {
+			for {
+				SweepTelegramPartials()
+				time.Sleep(gotdPartialSweepPeriod)
+			}
+		}()
+	})
+}
+
+// moveGotdPartial : the partial dir may be on another filesystem than the download dir
+func moveGotdPartial(partialPath string, filePath string) error {
+	err := os.Rename(partialPath, filePath)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	src, err := os.Open(partialPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return err
+	}
+	return os.Remove(partialPath)
+}
+
+func loadGotdPartialState(partialPath string, size int64) int64 {
+	data, err := os.ReadFile(partialPath + ".json")
+	if err != nil {
+		return 0
+	}
+	var state gotdPartialState
+	if json.Unmarshal(data, &state) != nil || state.Size != size || state.Offset%gotdPartSize != 0 {
+		return 0
+	}
+	stat, err := os.Stat(partialPath)
+	if err != nil || stat.Size() < state.Offset {
+		return 0
+	}
+	return state.Offset
+}
+
+func removeGotdPartial(partialPath string) {
+	os.Remove(partialPath)
+	os.Remove(partialPath + ".json")
+}
+
+// isGotdTransientError : connection errors and server side failures, other rpc errors will not go away by asking again
+func isGotdTransientError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	rpcErr, ok := tgerr.As(err)
+	if !ok {
+		return true
+	}
+	return rpcErr.Code >= 500 || rpcErr.Code == -503 || rpcErr.IsType("TIMEOUT")
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// gotdFileDownload : parts are handed out in order to the workers, offset only moves past parts that are written so it is
+// always safe to resume from
+type gotdFileDownload struct {
+	file        *gotdFile
+	gotdSession *GotdSession
+	prg         *GotdProgressWriter
+	partialPath string
+	next        int64
+	offset      int64
+	done        map[int64]bool
+	lastSave    time.Time
+	mut         sync.Mutex
+	locationMut sync.Mutex
+}
+
+func newGotdFileDownload(file *gotdFile, gotdSession *GotdSession, prg *GotdProgressWriter, partialPath string, offset int64) *gotdFileDownload {
+	return &gotdFileDownload{
+		file:        file,
+		gotdSession: gotdSession,
+		prg:         prg,
+		partialPath: partialPath,
+		next:        offset,
+		offset:      offset,
+		done:        make(map[int64]bool),
+		lastSave:    time.Now(),
+	}
+}
+
+func (d *gotdFileDownload) nextPart() (int64, bool) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	if d.next >= d.file.size {
+		return 0, false
+	}
+	offset := d.next
+	d.next += gotdPartSize
+	return offset, true
+}
+
+func (d *gotdFileDownload) partDone(offset int64) {
+	d.mut.Lock()
+	defer d.mut.Unlock()
+	d.done[offset] = true
+	for d.done[d.offset] {
+		delete(d.done, d.offset)
+		d.offset += gotdPartSize
+	}
+	if time.Since(d.lastSave) >= gotdStateInterval {
+		d.saveState()
+	}
+}
+
+// saveState : callers hold mut
+func (d *gotdFileDownload) saveState() {
+	d.lastSave = time.Now()
+	data, err := json.Marshal(gotdPartialState{Size: d.file.size, Offset: d.offset})
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(d.partialPath+".json", data, 0644)
+	if err != nil {
+		L().Warnf("GotdDownloader: failed to save resume state of %s: %v", d.file.filename, err)
+	}
+}
+
+func (d *gotdFileDownload) getLocation() tg.InputFileLocationClass {
+	d.locationMut.Lock()
+	defer d.locationMut.Unlock()
+	return d.file.location
+}
+
+// refreshLocation : file references expire after a while, the message carries a fresh one, workers that hit the same expired
+// reference only refetch it once
+func (d *gotdFileDownload) refreshLocation(ctx context.Context, stale tg.InputFileLocationClass) error {
+	d.locationMut.Lock()
+	defer d.locationMut.Unlock()
+	if d.file.location != stale {
+		return nil
+	}
+	m, err := gotdDownloader.refetchMessage(ctx, d.gotdSession, d.file.peer, d.file.messageID)
+	if err != nil {
+		return fmt.Errorf("failed to refresh the file reference of %s: %v", d.file.filename, err)
+	}
+	file, err := gotdDownloader.GetMessageFile(m)
+	if err != nil {
+		return fmt.Errorf("failed to refresh the file reference of %s: %v", d.file.filename, err)
+	}
+	L().Infof("GotdDownloader: refreshed the file reference of %s", d.file.filename)
+	d.file.location = file.location
+	return nil
+}
+
+func (d *gotdFileDownload) getPart(ctx context.Context, location tg.InputFileLocationClass, offset int64) ([]byte, error) {
+	err := acquireGotdPartRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := d.gotdSession.API().UploadGetFile(ctx, &tg.UploadGetFileRequest{
+		Location: location,
+		Offset:   offset,
+		Limit:    gotdPartSize,
+	})
+	releaseGotdPartRequest()
+	if err != nil {
+		return nil, err
+	}
+	part, ok := res.(*tg.UploadFile)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response %T", res)
+	}
+	expected := d.file.size - offset
+	if expected > gotdPartSize {
+		expected = gotdPartSize
+	}
+	if int64(len(part.Bytes)) != expected {
+		return nil, fmt.Errorf("short part at %d: got %d bytes, expected %d", offset, len(part.Bytes), expected)
+	}
+	return part.Bytes, nil
+}
+
+// fetchPart : FLOOD_WAIT is waited out, an expired file reference is refreshed and anything else transient is retried with backoff
+func (d *gotdFileDownload) fetchPart(ctx context.Context, offset int64) ([]byte, error) {
+	var err error
+	for attempt := 1; attempt <= gotdPartRetries; attempt++ {
+		if d.prg.IsCancelled() {
+			return nil, errGotdCanceled
+		}
+		location := d.getLocation()
+		var data []byte
+		data, err = d.getPart(ctx, location, offset)
+		if err == nil {
+			return data, nil
+		}
+		if wait, ok := tgerr.AsFloodWait(err); ok {
+			if wait > gotdMaxFloodWait {
+				return nil, err
+			}
+			L().Warnf("GotdDownloader: %s: flood wait of %s at offset %d", d.file.filename, wait, offset)
+			if sleepErr := sleepContext(ctx, wait); sleepErr != nil {
+				return nil, err
+			}
+			continue
+		}
+		if tgerr.Is(err, "FILE_REFERENCE_EXPIRED", "FILE_REFERENCE_INVALID") {
+			if refreshErr := d.refreshLocation(ctx, location); refreshErr != nil {
+				return nil, refreshErr
+			}
+			continue
+		}
+		if !isGotdTransientError(ctx, err) {
+			return nil, err
+		}
+		L().Warnf("GotdDownloader: %s: part at %d failed (attempt %d/%d): %v", d.file.filename, offset, attempt, gotdPartRetries, err)
+		if sleepErr := sleepContext(ctx, time.Duration(attempt)*time.Second); sleepErr != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("part at %d of %s failed after %d attempts: %v", offset, d.file.filename, gotdPartRetries, err)
+}
+
+// run : the first failing part stops the other workers, the resume state is saved either way
+func (d *gotdFileDownload) run(ctx context.Context, threads int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				offset, ok := d.nextPart()
+				if !ok {
+					return
+				}
+				data, err := d.fetchPart(ctx, offset)
+				if err == nil {
+					_, err = d.prg.WriteAt(data, offset)
+				}
+				if err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+				d.partDone(offset)
+			}
+		}()
+	}
+	wg.Wait()
+	d.mut.Lock()
+	d.saveState()
+	d.mut.Unlock()
+	return firstErr
+}
+
+// downloadFile : resumes from the partial file of an earlier attempt if there is one and moves the file into place once its size
+// matches the one telegram reported
+func (g *GotdDownloader) downloadFile(ctx context.Context, gotdSession *GotdSession, file *gotdFile, index int, prg *GotdProgressWriter) error {
+	key := acquireGotdPartial(file.key)
+	defer releaseGotdPartial(key)
+	partialPath := getGotdPartialPath(key)
+	err := os.MkdirAll(path.Dir(partialPath), 0755)
+	if err != nil {
+		return err
+	}
+	offset := loadGotdPartialState(partialPath, file.size)
+	writer, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	err = writer.Truncate(offset)
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	if offset > 0 {
+		L().Infof("GotdDownloader: resuming %s at %d/%d", file.filename, offset, file.size)
+	}
+	threads := chooseGotdThreads(file.size - offset)
+	prg.SetWriter(writer, index)
+	prg.SetThreads(threads)
+	prg.AddCompleted(offset)
+	start := time.Now()
+	err = newGotdFileDownload(file, gotdSession, prg, partialPath, offset).run(ctx, threads)
+	writer.Close()
+	if err != nil {
+		if !prg.IsCancelled() {
+			return err
+		}
+		if !isKeepingGotdPartials() {
+			removeGotdPartial(partialPath)
+		}
+		// whatever the workers failed with once the context was cancelled
+		return errGotdCanceled
+	}
+	recordGotdThroughput(threads, file.size-offset, time.Since(start))
+	stat, err := os.Stat(partialPath)
+	if err != nil {
+		return err
+	}
+	if stat.Size() != file.size {
+		removeGotdPartial(partialPath)
+		return fmt.Errorf("%s: downloaded %d bytes but telegram reported %d", file.filename, stat.Size(), file.size)
+	}
+	os.Remove(partialPath + ".json")
+	return moveGotdPartial(partialPath, file.filePath)
+}
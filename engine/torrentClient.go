@@ -0,0 +1,470 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
+)
+
+var nativeTorrentClient *torrent.Client
+var nativeTorrentClientMut sync.Mutex
+
+// NewTorrentDownload : adds the torrent to the engine selected by torrent_engine
+func NewTorrentDownload(link string, listener *MirrorListener, isSeed bool) error {
+	if utils.GetTorrentEngine() == utils.TorrentEngineNative {
+		return NewNativeTorrentDownload(link, listener, isSeed)
+	}
+	return NewKedgeDownload(link, listener, isSeed)
+}
+
+func GetNativeTorrentClientConfig() (*torrent.ClientConfig, error) {
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = utils.GetDownloadDir()
+	cfg.Seed = utils.GetSeed()
+	cfg.ListenPort = utils.GetTorrentClientListenPort()
+	cfg.Bep20 = utils.GetTorrentClientBep20()
+	cfg.UpnpID = utils.GetTorrentClientUpnpID()
+	cfg.HTTPUserAgent = utils.GetTorrentClientHTTPUserAgent()
+	cfg.ExtendedHandshakeClientVersion = utils.GetTorrentClientExtendedHandshakeClientVersion()
+	cfg.MinDialTimeout = utils.GetTorrentClientMinDialTimeout()
+	cfg.EstablishedConnsPerTorrent = utils.GetTorrentClientEstablishedConnsPerTorrent()
+	if utils.Config.TorrentClientMaxUploadRate != "" {
+		maxUploadRate, err := utils.GetTorrentClientMaxUploadRate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid torrent_client_max_upload_rate: %v", err)
+		}
+		if maxUploadRate > 0 {
+			cfg.UploadRateLimiter = rate.NewLimiter(rate.Limit(maxUploadRate), int(maxUploadRate))
+		}
+	}
+	return cfg, nil
+}
+
+// GetNativeTorrentClient : in-process torrent client, created on first use so kedge deployments never bind the port
+func GetNativeTorrentClient() (*torrent.Client, error) {
+	nativeTorrentClientMut.Lock()
+	defer nativeTorrentClientMut.Unlock()
+	if nativeTorrentClient != nil {
+		return nativeTorrentClient, nil
+	}
+	cfg, err := GetNativeTorrentClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := torrent.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	nativeTorrentClient = client
+	L().Infof("[NativeTorrent]: client started on port %d", cfg.ListenPort)
+	return nativeTorrentClient, nil
+}
+
+func NewNativeTorrentDownloader(client *torrent.Client) *NativeTorrentDownloader {
+	return &NativeTorrentDownloader{client: client}
+}
+
+type NativeTorrentDownloader struct {
+	client *torrent.Client
+}
+
+func (n *NativeTorrentDownloader) AddDownload(link string, listener *MirrorListener, isSeed bool) error {
+	dir := path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(listener.GetUid()))
+	gid := utils.RandString(16)
+	initializingStatus := NewInitializingStatus(utils.TrimString(link), gid, dir, listener)
+	initializingStatus.Index_ = GenerateMirrorIndex()
+	AddMirrorLocal(listener.GetUid(), initializingStatus)
+	go n.PrepDownload(gid, link, dir, listener, initializingStatus.Index(), isSeed)
+	return nil
+}
+
+func (n *NativeTorrentDownloader) PrepDownload(gid string, link string, dir string, listener *MirrorListener, index int, isSeed bool) {
+	props, err := GetTorrentProps(link)
+	if err != nil {
+		listener.OnDownloadError(err.Error())
+		return
+	}
+	if _, exists := n.client.Torrent(props.Spec.InfoHash); exists {
+		listener.OnDownloadError(fmt.Sprintf("infohash %s is already registered in the client", props.Spec.InfoHash.HexString()))
+		return
+	}
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		L().Errorf("[NativeTorrent]: AddDownload: os.MkdirAll: %s, %v", link, err)
+		listener.OnDownloadError(err.Error())
+		return
+	}
+	fileStorage := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	props.Spec.Storage = fileStorage
+	t, _, err := n.client.AddTorrentSpec(props.Spec)
+	if err != nil {
+		L().Errorf("[NativeTorrent]: AddDownload: AddTorrentSpec: %v", err)
+		fileStorage.Close()
+		listener.OnDownloadError(err.Error())
+		return
+	}
+	listener.isTorrent = true
+	listener.isSeed = isSeed
+	torrentListener := NewNativeTorrentListener(t, fileStorage, listener, isSeed)
+	status := NewNativeTorrentStatus(gid, listener, torrentListener, props)
+	status.Index_ = index
+	torrentListener.StartListener()
+	AddMirrorLocal(listener.GetUid(), status)
+	status.GetListener().OnDownloadStart(status.Gid())
+}
+
+func NewNativeTorrentDownload(link string, listener *MirrorListener, isSeed bool) error {
+	client, err := GetNativeTorrentClient()
+	if err != nil {
+		return err
+	}
+	return NewNativeTorrentDownloader(client).AddDownload(link, listener, isSeed)
+}
+
+func NewNativeTorrentListener(t *torrent.Torrent, fileStorage storage.ClientImplCloser, listener *MirrorListener, isSeed bool) *NativeTorrentListener {
+	return &NativeTorrentListener{
+		torrent:     t,
+		fileStorage: fileStorage,
+		listener:    listener,
+		isSeed:      isSeed,
+	}
+}
+
+type NativeTorrentListener struct {
+	torrent           *torrent.Torrent
+	fileStorage       storage.ClientImplCloser
+	listener          *MirrorListener
+	IsListenerRunning bool
+	IsWatcherRunning  bool
+	isSeed            bool
+	isDropped         bool
+	IsSeeding         bool
+	haveInfo          bool
+	DownloadSpeed     int64
+	SeedingSpeed      int64
+	UploadedBytes     int64
+	CompletedTime     time.Time
+	lastDownloaded    int64
+	dropMut           sync.Mutex
+}
+
+func (n *NativeTorrentListener) OnDownloadStart() {
+	L().Infof("[NativeTorrent]: download start: %s", n.torrent.InfoHash().HexString())
+}
+
+func (n *NativeTorrentListener) OnMetadataDownloadComplete() {
+	n.haveInfo = true
+	n.torrent.DownloadAll()
+	L().Infof("[NativeTorrent]: metadata complete: %s", n.torrent.InfoHash().HexString())
+}
+
+func (n *NativeTorrentListener) OnDownloadComplete() {
+	n.StopListener()
+	n.CompletedTime = time.Now()
+	L().Infof("[NativeTorrent]: download complete: %s", n.torrent.InfoHash().HexString())
+	if n.isSeed {
+		n.IsSeeding = true
+		n.OnSeedingStart()
+	} else {
+		n.Drop()
+	}
+	n.listener.OnDownloadComplete()
+}
+
+func (n *NativeTorrentListener) OnDownloadStop(err error) {
+	n.StopListener()
+	n.Drop()
+	L().Error(err)
+	n.listener.OnDownloadError(err.Error())
+}
+
+func (n *NativeTorrentListener) OnSeedingStart() {
+	L().Infof("[NativeTorrent]: OnSeedingStart: %s", n.torrent.InfoHash().HexString())
+	n.listener.OnSeedingStart(n.listener.GetDownload().Gid())
+	n.StartSeedingWatcher()
+}
+
+func (n *NativeTorrentListener) OnSeedingComplete() {
+	n.StopSeedingWatcher()
+	n.Drop()
+	seedTime := n.listener.GetSeedTime()
+	text := fmt.Sprintf("Ratio: %.2f, SeedTime: %s", n.GetRatio(), utils.HumanizeDuration(seedTime))
+	n.listener.OnSeedingComplete(text)
+}
+
+func (n *NativeTorrentListener) OnSeedingError(err error) {
+	n.StopSeedingWatcher()
+	n.Drop()
+	seedTime := n.listener.GetSeedTime()
+	text := fmt.Sprintf("%s. Ratio: %.2f, SeedTime: %s", err.Error(), n.GetRatio(), utils.HumanizeDuration(seedTime))
+	n.listener.OnSeedingError(fmt.Errorf(text))
+}
+
+// Drop : removes the torrent from the client, the downloaded files stay on disk
+func (n *NativeTorrentListener) Drop() {
+	n.dropMut.Lock()
+	defer n.dropMut.Unlock()
+	if n.isDropped {
+		return
+	}
+	n.isDropped = true
+	n.torrent.Drop()
+	err := n.fileStorage.Close()
+	if err != nil {
+		L().Errorf("[NativeTorrent]: error while closing storage: %v", err)
+	}
+}
+
+func (n *NativeTorrentListener) GetRatio() float64 {
+	if !n.haveInfo || n.torrent.Length() == 0 {
+		return 0
+	}
+	return float64(n.UploadedBytes) / float64(n.torrent.Length())
+}
+
+func (n *NativeTorrentListener) getUploadedBytes() int64 {
+	stats := n.torrent.Stats()
+	return stats.BytesWrittenData.Int64()
+}
+
+func (n *NativeTorrentListener) StartListener() {
+	n.IsListenerRunning = true
+	go n.ListenForEvents()
+}
+
+func (n *NativeTorrentListener) StopListener() {
+	n.IsListenerRunning = false
+}
+
+func (n *NativeTorrentListener) ListenForEvents() {
+	n.OnDownloadStart()
+	for n.IsListenerRunning {
+		if !n.haveInfo {
+			select {
+			case <-n.torrent.GotInfo():
+				n.OnMetadataDownloadComplete()
+			case <-time.After(1 * time.Second):
+				continue
+			}
+		}
+		completed := n.torrent.BytesCompleted()
+		n.DownloadSpeed = completed - n.lastDownloaded
+		n.lastDownloaded = completed
+		n.UploadedBytes = n.getUploadedBytes()
+		if completed >= n.torrent.Length() {
+			n.OnDownloadComplete()
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func (n *NativeTorrentListener) StartSeedingWatcher() {
+	n.IsWatcherRunning = true
+	go n.WatchSeeding()
+}
+
+func (n *NativeTorrentListener) StopSeedingWatcher() {
+	n.IsWatcherRunning = false
+}
+
+// WatchSeeding : tracks upload stats of the seeding torrent and drops it once the seed policy is satisfied
+func (n *NativeTorrentListener) WatchSeeding() {
+	policy := n.listener.GetSeedPolicy()
+	L().Infof("[NativeTorrent]: seed policy for %s: %s", n.torrent.InfoHash().HexString(), policy.String())
+	for n.IsWatcherRunning {
+		uploaded := n.getUploadedBytes()
+		n.SeedingSpeed = uploaded - n.UploadedBytes
+		n.UploadedBytes = uploaded
+		// never remove files which are still being uploaded
+		if n.listener.IsUploadDone() && policy.IsReached(n.GetRatio(), n.listener.GetSeedTime()) {
+			n.OnSeedingComplete()
+			break
+		}
+		time.Sleep(1 * time.Second)
+	}
+}
+
+func NewNativeTorrentStatus(gid string, listener *MirrorListener, torrentListener *NativeTorrentListener, props *TorrentProps) *NativeTorrentStatus {
+	return &NativeTorrentStatus{
+		gid:             gid,
+		listener:        listener,
+		torrentListener: torrentListener,
+		props:           props,
+	}
+}
+
+type NativeTorrentStatus struct {
+	gid             string
+	listener        *MirrorListener
+	torrentListener *NativeTorrentListener
+	props           *TorrentProps
+	Index_          int
+	isCanceled      bool
+}
+
+func (n *NativeTorrentStatus) Name() string {
+	if !n.torrentListener.haveInfo {
+		if n.props.Spec.DisplayName != "" {
+			return n.props.Spec.DisplayName
+		}
+		return fmt.Sprintf("infohash:%s", n.props.Spec.InfoHash.HexString())
+	}
+	return n.torrentListener.torrent.Name()
+}
+
+func (n *NativeTorrentStatus) TotalLength() int64 {
+	if !n.torrentListener.haveInfo {
+		return 0
+	}
+	return n.torrentListener.torrent.Length()
+}
+
+func (n *NativeTorrentStatus) CompletedLength() int64 {
+	if n.torrentListener.IsSeeding {
+		return n.torrentListener.UploadedBytes
+	}
+	return n.torrentListener.lastDownloaded
+}
+
+func (n *NativeTorrentStatus) Speed() int64 {
+	if n.torrentListener.IsSeeding {
+		return n.torrentListener.SeedingSpeed
+	}
+	return n.torrentListener.DownloadSpeed
+}
+
+func (n *NativeTorrentStatus) ETA() *time.Duration {
+	if n.torrentListener.IsSeeding {
+		dur := n.listener.GetSeedTime()
+		return &dur
+	}
+	dur := utils.CalculateETA(n.TotalLength()-n.CompletedLength(), n.Speed())
+	return &dur
+}
+
+func (n *NativeTorrentStatus) Gid() string {
+	return n.gid
+}
+
+func (n *NativeTorrentStatus) Path() string {
+	return path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(n.GetListener().GetUid()), n.Name())
+}
+
+func (n *NativeTorrentStatus) Percentage() float32 {
+	if n.TotalLength() == 0 {
+		return float32(0.00)
+	}
+	return float32(n.CompletedLength()*100) / float32(n.TotalLength())
+}
+
+func (n *NativeTorrentStatus) GetStatusType() string {
+	if n.isCanceled {
+		return MirrorStatusCanceled
+	}
+	if n.torrentListener.IsSeeding {
+		return MirrorStatusSeeding
+	}
+	return MirrorStatusDownloading
+}
+
+func (n *NativeTorrentStatus) IsTorrent() bool {
+	return true
+}
+
+func (n *NativeTorrentStatus) PiecesCompleted() int {
+	if n.torrentListener.isDropped {
+		return 0
+	}
+	return n.torrentListener.torrent.Stats().PiecesComplete
+}
+
+func (n *NativeTorrentStatus) PiecesTotal() int {
+	if !n.torrentListener.haveInfo {
+		return 0
+	}
+	return n.torrentListener.torrent.NumPieces()
+}
+
+func (n *NativeTorrentStatus) GetPeers() int {
+	if n.torrentListener.isDropped {
+		return 0
+	}
+	return n.torrentListener.torrent.Stats().ActivePeers
+}
+
+func (n *NativeTorrentStatus) GetSeeders() int {
+	if n.torrentListener.isDropped {
+		return 0
+	}
+	return n.torrentListener.torrent.Stats().ConnectedSeeders
+}
+
+func (n *NativeTorrentStatus) Index() int {
+	return n.Index_
+}
+
+func (n *NativeTorrentStatus) GetListener() *MirrorListener {
+	return n.listener
+}
+
+func (n *NativeTorrentStatus) GetCloneListener() *CloneListener {
+	return nil
+}
+
+func (n *NativeTorrentStatus) GetSeedRatio() float64 {
+	return n.torrentListener.GetRatio()
+}
+
+func (n *NativeTorrentStatus) GetSeedPolicy() *SeedPolicy {
+	return n.listener.GetSeedPolicy()
+}
+
+func (n *NativeTorrentStatus) GetSeedTimeRemaining() *time.Duration {
+	return n.listener.GetSeedPolicy().RemainingTime(n.listener.GetSeedTime())
+}
+
+func (n *NativeTorrentStatus) GetDetails() string {
+	out := "<b>Torrent (native)</b>\n"
+	out += fmt.Sprintf("InfoHash: <code>%s</code>\n", n.props.Spec.InfoHash.HexString())
+	out += fmt.Sprintf("Trackers (spec): <code>%d</code>\n", len(n.props.Spec.Trackers))
+	if n.torrentListener.isDropped {
+		out += "Torrent dropped from client.\n"
+		return out
+	}
+	stats := n.torrentListener.torrent.Stats()
+	out += fmt.Sprintf("Peers: <code>%d</code> active, <code>%d</code> pending, <code>%d</code> half open, <code>%d</code> known\n", stats.ActivePeers, stats.PendingPeers, stats.HalfOpenPeers, stats.TotalPeers)
+	out += fmt.Sprintf("Seeds: <code>%d</code>\n", stats.ConnectedSeeders)
+	out += fmt.Sprintf("Pieces: <code>%d/%d</code>\n", stats.PiecesComplete, n.PiecesTotal())
+	out += fmt.Sprintf("Ratio: <code>%.3f</code> (up <code>%s</code>, down <code>%s</code>)\n", n.GetSeedRatio(), utils.GetHumanBytes(stats.BytesWrittenData.Int64()), utils.GetHumanBytes(stats.BytesReadUsefulData.Int64()))
+	out += fmt.Sprintf("Wasted: <code>%d</code> chunks, <code>%d</code> bad pieces\n", stats.ChunksReadWasted.Int64(), stats.PiecesDirtiedBad.Int64())
+	if n.torrentListener.haveInfo {
+		out += fmt.Sprintf("Name: <code>%s</code>\n", html.EscapeString(n.torrentListener.torrent.Name()))
+	}
+	return out
+}
+
+func (n *NativeTorrentStatus) CancelMirror() bool {
+	if n.isCanceled {
+		return true
+	}
+	n.isCanceled = true
+	n.torrentListener.StopListener()
+	if n.torrentListener.IsSeeding {
+		n.torrentListener.OnSeedingError(fmt.Errorf("Cancelled by user"))
+	} else {
+		n.torrentListener.OnDownloadStop(fmt.Errorf("canceled by user"))
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"bufio"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const TrackerListRefreshInterval = 6 * time.Hour
+
+// TrackerListRetryInterval : how long a failed fetch keeps torrent adds from trying again
+const TrackerListRetryInterval = 5 * time.Minute
+
+var trackerListCache *TrackerListCache = NewTrackerListCache(utils.GetTorrentTrackerListURL())
+
+func NewTrackerListCache(url string) *TrackerListCache {
+	return &TrackerListCache{
+		url:        url,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// TrackerListCache : keeps the last successfully fetched tracker list, a failed refresh never clears it
+type TrackerListCache struct {
+	url         string
+	httpClient  *http.Client
+	trackers    []string
+	lastFetched time.Time
+	lastAttempt time.Time
+	lastError   error
+	isRunning   bool
+	refreshing  bool
+	mut         sync.RWMutex
+}
+
+func (t *TrackerListCache) fetch() ([]string, error) {
+	res, err := t.httpClient.Get(t.url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("got response code of %d", res.StatusCode)
+	}
+	var trackers []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		tracker := strings.TrimSpace(scanner.Text())
+		if tracker == "" || strings.HasPrefix(tracker, "#") || seen[tracker] {
+			continue
+		}
+		seen[tracker] = true
+		trackers = append(trackers, tracker)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(trackers) == 0 {
+		return nil, fmt.Errorf("tracker list is empty")
+	}
+	return trackers, nil
+}
+
+// Refresh : fetches the tracker list, on failure the cached list is kept and returned along with the error
+func (t *TrackerListCache) Refresh() ([]string, error) {
+	trackers, err := t.fetch()
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.lastAttempt = time.Now()
+	t.lastError = err
+	if err != nil {
+		L().Errorf("[TrackerList]: refresh failed, using %d cached trackers: %v", len(t.trackers), err)
+		return t.trackers, err
+	}
+	t.trackers = trackers
+	t.lastFetched = time.Now()
+	L().Infof("[TrackerList]: fetched %d trackers from %s", len(trackers), t.url)
+	return t.trackers, nil
+}
+
+// startRefresh : true if the caller should refresh, at most one refresh runs and failed ones are not retried for a while
+func (t *TrackerListCache) startRefresh() bool {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.refreshing || time.Now().Sub(t.lastAttempt) < TrackerListRetryInterval {
+		return false
+	}
+	t.refreshing = true
+	return true
+}
+
+func (t *TrackerListCache) refreshOnce() ([]string, error) {
+	defer func() {
+		t.mut.Lock()
+		t.refreshing = false
+		t.mut.Unlock()
+	}()
+	return t.Refresh()
+}
+
+// GetTrackers : cached trackers, a stale list is served while it refreshes in the background, only an empty cache is fetched
+// right away and a failed fetch is not retried by every torrent add
+func (t *TrackerListCache) GetTrackers() []string {
+	t.mut.RLock()
+	trackers := t.trackers
+	isStale := time.Now().Sub(t.lastFetched) > TrackerListRefreshInterval
+	t.mut.RUnlock()
+	if len(trackers) == 0 {
+		if t.startRefresh() {
+			trackers, _ = t.refreshOnce()
+		}
+		return trackers
+	}
+	if isStale && t.startRefresh() {
+		go t.refreshOnce()
+	}
+	return trackers
+}
+
+func (t *TrackerListCache) StartRefresher() {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	if t.isRunning {
+		return
+	}
+	t.isRunning = true
+	go func() {
+		for {
+			t.Refresh()
+			time.Sleep(TrackerListRefreshInterval)
+		}
+	}()
+}
+
+func (t *TrackerListCache) GetInfoString() string {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	out := fmt.Sprintf("URL: <code>%s</code>\n", html.EscapeString(t.url))
+	out += fmt.Sprintf("Enabled: <code>%t</code>\n", utils.GetTorrentUseTrackerList())
+	out += fmt.Sprintf("Trackers: <code>%d</code>\n", len(t.trackers))
+	if t.lastFetched.IsZero() {
+		out += "LastFetched: <code>never</code>\n"
+	} else {
+		out += fmt.Sprintf("LastFetched: <code>%s ago</code>\n", utils.HumanizeDuration(time.Now().Sub(t.lastFetched)))
+	}
+	if t.lastError != nil {
+		out += fmt.Sprintf("LastError: <code>%s</code>\n", html.EscapeString(t.lastError.Error()))
+	}
+	return out
+}
+
+func (t *TrackerListCache) GetCachedTrackers() []string {
+	t.mut.RLock()
+	defer t.mut.RUnlock()
+	return append([]string(nil), t.trackers...)
+}
+
+func GetTrackerListCache() *TrackerListCache {
+	return trackerListCache
+}
+
+// InjectTrackersIntoMagnet : appends the trackers missing from the magnet as tr params
+func InjectTrackersIntoMagnet(link string, trackers []string) string {
+	magnet, err := metainfo.ParseMagnetUri(link)
+	if err != nil {
+		L().Errorf("[TrackerList]: ParseMagnetUri: %v", err)
+		return link
+	}
+	existing := make(map[string]bool)
+	for _, tracker := range magnet.Trackers {
+		existing[tracker] = true
+	}
+	for _, tracker := range trackers {
+		if existing[tracker] {
+			continue
+		}
+		existing[tracker] = true
+		link += "&tr=" + url.QueryEscape(tracker)
+	}
+	return link
+}
+
+// InjectTrackersIntoMetaInfo : appends the trackers missing from the announce list as a new tier
+func InjectTrackersIntoMetaInfo(meta *metainfo.MetaInfo, trackers []string) {
+	announceList := meta.UpvertedAnnounceList()
+	existing := make(map[string]bool)
+	for _, tracker := range announceList.DistinctValues() {
+		existing[tracker] = true
+	}
+	var tier []string
+	for _, tracker := range trackers {
+		if existing[tracker] {
+			continue
+		}
+		existing[tracker] = true
+		tier = append(tier, tracker)
+	}
+	if len(tier) == 0 {
+		return
+	}
+	meta.AnnounceList = append(announceList, tier)
+	if meta.Announce == "" {
+		meta.Announce = tier[0]
+	}
+}
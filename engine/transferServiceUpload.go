@@ -3,9 +3,11 @@ package engine
 import (
 	"MirrorBotGo/utils"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -152,6 +154,9 @@ func (t *TransferServiceClient) CancelTransfer(u *CancelRequest) (string, error)
 }
 
 func (t *TransferServiceClient) AddUpload(u *UploadRequest) (string, error) {
+	if err := transferServiceBackend.Ensure(); err != nil {
+		return "", err
+	}
 	data, err := u.Marshal()
 	if err != nil {
 		return "", fmt.Errorf("jsonMarshal: %v", err)
@@ -187,6 +192,9 @@ func (t *TransferServiceClient) AddUpload(u *UploadRequest) (string, error) {
 }
 
 func (t *TransferServiceClient) AddClone(u *CloneRequest) (string, error) {
+	if err := transferServiceBackend.Ensure(); err != nil {
+		return "", err
+	}
 	data, err := u.Marshal()
 	if err != nil {
 		return "", fmt.Errorf("jsonMarshal: %v", err)
@@ -257,6 +265,9 @@ func (t *TransferServiceClient) ListFiles(u *ListFilesRequest) (*ListFilesRespon
 }
 
 func (t *TransferServiceClient) AddDownload(u *DownloadRequest) (string, error) {
+	if err := transferServiceBackend.Ensure(); err != nil {
+		return "", err
+	}
 	data, err := u.Marshal()
 	if err != nil {
 		return "", fmt.Errorf("jsonMarshal: %v", err)
@@ -359,6 +370,9 @@ func NewTransferServiceClient(apiUrl string, client *http.Client) *TransferServi
 }
 
 var transferServiceClient *TransferServiceClient = NewTransferServiceClient(utils.GetTransferServiceURL(), &http.Client{})
+var transferServiceBackend *Backend = NewBackend("Transfer service", func(ctx context.Context) (string, error) {
+	return checkHTTPBackend(ctx, utils.GetTransferServiceURL())
+}, nil, nil).MarkCritical()
 
 type GoogleDriveTransferStatus struct {
 	gid           string
@@ -469,6 +483,18 @@ func (g *GoogleDriveTransferStatus) Index() int {
 	return g.Index_
 }
 
+func (g *GoogleDriveTransferStatus) GetDetails() string {
+	status, err := transferServiceClient.GetStatusByGid(g.gid)
+	if err != nil && status == nil {
+		return fmt.Sprintf("<b>Transfer Service</b>\nError: <code>%s</code>", html.EscapeString(err.Error()))
+	}
+	data, err := json.MarshalIndent(status, "", " ")
+	if err != nil {
+		return fmt.Sprintf("<b>Transfer Service</b>\nError: <code>%s</code>", html.EscapeString(err.Error()))
+	}
+	return fmt.Sprintf("<b>Transfer Service</b>\n<code>%s</code>", html.EscapeString(string(data)))
+}
+
 func (g *GoogleDriveTransferStatus) CancelMirror() bool {
 	g.isCancelled = true
 	_, err := transferServiceClient.CancelTransfer(&CancelRequest{
@@ -2,9 +2,11 @@ package engine
 
 import (
 	"MirrorBotGo/utils"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -18,13 +20,16 @@ import (
 )
 
 var usenetClient *nzbget.NZBGet = getUsenetClient()
+var usenetBackend *Backend = NewBackend("NZBGet", checkUsenetClient, onUsenetConnect, nil)
 var usenetActiveDls []string
 var usenetMutex sync.Mutex
-var isRPCConnected bool = false
 
 var GroupRespNotFoundErr = errors.New("(GroupResp): NZB download not found")
 var HistoryRespNotFoundErr = errors.New("(HistoryResp): NZB download not found")
 
+// usenetMaxHistoryMisses : a download that left the queue but is not in the history either was deleted in nzbget
+const usenetMaxHistoryMisses = 30
+
 func isUsenetDlExist(dl string) bool {
 	usenetMutex.Lock()
 	defer usenetMutex.Unlock()
@@ -63,8 +68,9 @@ func removeUsenetActiveDl(dl string) {
 	usenetActiveDls[index] = ""
 }
 
+// getUsenetClient : only builds the client, usenetBackend connects on first use
 func getUsenetClient() *nzbget.NZBGet {
-	nzb := nzbget.New(&nzbget.Config{
+	return nzbget.New(&nzbget.Config{
 		URL:  utils.GetUsenetClientURL(),
 		User: utils.GetUsenetClientUsername(),
 		Pass: utils.GetUsenetClientPassword(),
@@ -72,22 +78,31 @@ func getUsenetClient() *nzbget.NZBGet {
 			Timeout: 20 * time.Second,
 		},
 	})
-	events, err := nzb.Log(0, 100)
+}
+
+func checkUsenetClient(ctx context.Context) (string, error) {
+	return usenetClient.VersionContext(ctx)
+}
+
+func onUsenetConnect() {
+	version, err := usenetClient.Version()
+	if err == nil {
+		L().Infof("NZBGet version %s", version)
+	}
+	events, err := usenetClient.Log(0, 100)
 	if err != nil {
-		return nil
+		return
 	}
-	isRPCConnected = true
 	for _, event := range events {
 		L().Info(event.ID, event.Kind, event.Time, event.Text)
 	}
-	conf, err := nzb.Config()
+	conf, err := usenetClient.Config()
 	if err != nil {
-		return nzb
+		return
 	}
 	for _, c := range conf {
 		L().Infof("%s = %s", c.Name, c.Value)
 	}
-	return nzb
 }
 
 func GetGroupRespByNZBID(nzbID int64) (*nzbget.Group, error) {
@@ -128,6 +143,7 @@ type UsenetDownloadListener struct {
 	Content           string
 	NzbID             int64
 	handled           bool
+	isCancelled       bool
 	listener          *MirrorListener
 	IsListenerRunning bool
 	Speed             int64
@@ -165,44 +181,109 @@ func (u *UsenetDownloadListener) OnDownloadError(err string) {
 	}
 	u.handled = true
 	removeUsenetActiveDl(u.Content)
+	// the group may already be gone from nzbget, the mirror fails either way
 	_, err2 := usenetClient.EditQueue("GroupDelete", "", []int64{u.NzbID})
 	if err2 != nil {
 		L().Errorf("UsenetDownloadListener: OnDownloadError: EditQueue: GroupDelete: %d : %v", u.NzbID, err2)
-		return
 	}
 	u.StopListener()
 	u.listener.OnDownloadError(err)
 }
 
+// getUsenetFailureReason : empty when the files are usable, history statuses are <class>/<detail> such as FAILURE/PAR or DELETED/HEALTH
+func getUsenetFailureReason(history *nzbget.History, isCancelled bool) string {
+	parts := strings.SplitN(history.Status, "/", 2)
+	class, detail := parts[0], ""
+	if len(parts) > 1 {
+		detail = parts[1]
+	}
+	switch class {
+	case "SUCCESS":
+		return ""
+	case "WARNING":
+		// the files are fine when only a post-processing script complained
+		if detail == "SCRIPT" {
+			return ""
+		}
+	case "DELETED":
+		if isCancelled {
+			return "Canceled by user."
+		}
+	}
+	reason := ""
+	switch detail {
+	case "HEALTH":
+		reason = fmt.Sprintf("too many articles are missing, health %.1f%% is below the critical %.1f%%", float64(history.Health)/10, float64(history.CriticalHealth)/10)
+	case "PAR", "DAMAGED":
+		reason = "par repair failed, the download is damaged"
+	case "REPAIRABLE":
+		reason = "the download is damaged, it can be repaired but par repair did not run"
+	case "UNPACK":
+		reason = "unpacking failed"
+	case "SPACE":
+		reason = "not enough disk space to unpack"
+	case "PASSWORD":
+		reason = "the archive needs a password or the one given is wrong"
+	case "MOVE":
+		reason = "moving the files to the destination failed"
+	case "SCRIPT":
+		reason = "a post-processing script failed"
+	case "BAD":
+		reason = "the download was marked as bad"
+	case "DUPE", "COPY":
+		reason = "nzbget removed it as a duplicate"
+	case "SCAN":
+		reason = "nzbget could not parse the nzb"
+	case "MANUAL":
+		reason = "the download was deleted in nzbget"
+	case "FETCH":
+		reason = "fetching the nzb failed"
+	default:
+		reason = history.Status
+	}
+	return "Usenet download failed: " + reason
+}
+
+// onHistory : items only move to the history once nzbget is done with them, whatever the outcome
+func (u *UsenetDownloadListener) onHistory(history *nzbget.History) {
+	u.pth = path.Join(u.futurePath, history.Name)
+	L().Infof("[UsenetRename]: %s -> %s", history.DestDir, u.pth)
+	err := os.Rename(history.DestDir, u.pth)
+	if err != nil && !os.IsNotExist(err) {
+		L().Errorf("UsenetDownloadListener: rename: %s -> %s : %v", history.DestDir, u.pth, err)
+	}
+	reason := getUsenetFailureReason(history, u.isCancelled)
+	if reason != "" {
+		L().Infof("[UsenetFailed]: %s: %s (par %s, unpack %s, move %s)", history.Name, history.Status, history.ParStatus, history.UnpackStatus, history.MoveStatus)
+		u.OnDownloadError(reason)
+		return
+	}
+	u.OnDownloadComplete()
+}
+
 func (u *UsenetDownloadListener) ListenForEvents() {
 	var last int64 = 0
+	misses := 0
 	for u.IsListenerRunning {
 		group, err := GetGroupRespByNZBID(u.NzbID)
 		if err == GroupRespNotFoundErr {
 			history, err := GetHistoryRespByNZBID(u.NzbID)
-			if err != nil {
-				L().Error(err)
-			}
-			if strings.Contains(history.Status, "SUCCESS") {
-				u.pth = path.Join(u.futurePath, history.Name)
-				L().Infof("[UsenetRename]: %s -> %s", history.DestDir, u.pth)
-				L().Error(os.Rename(history.DestDir, u.pth))
-				u.OnDownloadComplete()
+			if err == nil {
+				u.onHistory(history)
 				return
-			} else if strings.Contains(history.Status, "FAILURE") {
-				u.pth = path.Join(u.futurePath, history.Name)
-				err := os.Rename(history.DestDir, u.pth)
-				if err != nil {
-					L().Errorf("UsenetDownloadListener: usenet download fail: rename: %s -> %s : %v", history.DestDir, u.pth, err)
-					return
-				}
-				u.OnDownloadError("usenet download failed")
+			}
+			misses++
+			L().Errorf("UsenetDownloadListener: %d : %v (%d/%d)", u.NzbID, err, misses, usenetMaxHistoryMisses)
+			if misses >= usenetMaxHistoryMisses {
+				u.OnDownloadError("The download is gone from NZBGet, neither the queue nor the history has it.")
 				return
 			}
 		}
 		if group == nil {
+			time.Sleep(1 * time.Second)
 			continue
 		}
+		misses = 0
 		if group.Status == nzbget.GroupPAUSED {
 			u.OnDownloadError("Canceled by user.")
 			return
@@ -215,12 +296,37 @@ func (u *UsenetDownloadListener) ListenForEvents() {
 	}
 }
 
+// getUsenetStage : the status type of each nzbget group status, par check and repair, unpacking and the rest of post-processing
+// are told apart since they can take as long as the download
+func getUsenetStage(status nzbget.GroupStatus) string {
+	switch status {
+	case nzbget.GroupQUEUED, nzbget.GroupPPQUEUED:
+		return MirrorStatusWaiting
+	case nzbget.GroupLOADINGPARS, nzbget.GroupVERIFYINGSOURCES, nzbget.GroupVERIFYINGREPAIRED:
+		return MirrorStatusVerifying
+	case nzbget.GroupREPAIRING:
+		return MirrorStatusRepairing
+	case nzbget.GroupUNPACKING:
+		return MirrorStatusUnpacking
+	case nzbget.GroupRENAMING, nzbget.GroupMOVING, nzbget.GroupEXECUTINGSCRIPT, nzbget.GroupPPFINISHED:
+		return MirrorStatusPostProcessing
+	}
+	return MirrorStatusDownloading
+}
+
+func isUsenetPostProcessing(stage string) bool {
+	return stage == MirrorStatusVerifying || stage == MirrorStatusRepairing || stage == MirrorStatusUnpacking || stage == MirrorStatusPostProcessing
+}
+
+// UsenetDownloadStatusStruct : StageProgress and StageTime describe the current post-processing stage, progress is in per mille
 type UsenetDownloadStatusStruct struct {
-	Name      string
-	Completed int64
-	Total     int64
-	Path      string
-	IsQueued  bool
+	Name          string
+	Completed     int64
+	Total         int64
+	Path          string
+	Stage         string
+	StageProgress int64
+	StageTime     time.Duration
 }
 
 func NewUsenetDownloadStatus(gid string, usenetListener *UsenetDownloadListener, nzbID int64) *UsenetDownloadStatus {
@@ -258,8 +364,12 @@ func (u *UsenetDownloadStatus) GetStatus() UsenetDownloadStatusStruct {
 	status.Completed = group.DownloadedSizeMB * 1024 * 1024
 	status.Total = group.FileSizeMB * 1024 * 1024
 	status.Path = group.DestDir
-	if group.Status == nzbget.GroupPPQUEUED || group.Status == nzbget.GroupQUEUED {
-		status.IsQueued = true
+	status.Stage = getUsenetStage(group.Status)
+	if isUsenetPostProcessing(status.Stage) {
+		status.StageProgress = group.PostStageProgress
+		status.StageTime = time.Duration(group.PostStageTimeSec) * time.Second
+		// the progress bar follows the stage instead of the finished download
+		status.Completed = status.Total * status.StageProgress / 1000
 	}
 	return status
 }
@@ -295,8 +405,17 @@ func (u *UsenetDownloadStatus) Percentage() float32 {
 	return float32(u.CompletedLength()*100) / float32(u.TotalLength())
 }
 
+// ETA : post-processing stages are estimated from the time the stage has taken so far
 func (u *UsenetDownloadStatus) ETA() *time.Duration {
-	dur := utils.CalculateETA(u.TotalLength()-u.CompletedLength(), u.Speed())
+	status := u.GetStatus()
+	if isUsenetPostProcessing(status.Stage) {
+		var dur time.Duration
+		if status.StageProgress > 0 {
+			dur = status.StageTime * time.Duration(1000-status.StageProgress) / time.Duration(status.StageProgress)
+		}
+		return &dur
+	}
+	dur := utils.CalculateETA(status.Total-status.Completed, u.Speed())
 	return &dur
 }
 
@@ -304,10 +423,11 @@ func (u *UsenetDownloadStatus) GetStatusType() string {
 	if u.isCancelled {
 		return MirrorStatusCanceled
 	}
-	if u.GetStatus().IsQueued {
-		return MirrorStatusWaiting
+	stage := u.GetStatus().Stage
+	if stage == "" {
+		return MirrorStatusDownloading
 	}
-	return MirrorStatusDownloading
+	return stage
 }
 
 func (u *UsenetDownloadStatus) Path() string {
@@ -345,9 +465,43 @@ func (u *UsenetDownloadStatus) Index() int {
 	return u.Index_
 }
 
+func (u *UsenetDownloadStatus) GetDetails() string {
+	out := "<b>Usenet</b>\n"
+	out += fmt.Sprintf("NZBID: <code>%d</code>\n", u.nzbID)
+	group, err := GetGroupRespByNZBID(u.nzbID)
+	if err != nil {
+		history, err := GetHistoryRespByNZBID(u.nzbID)
+		if err != nil {
+			out += fmt.Sprintf("Error: <code>%s</code>", html.EscapeString(err.Error()))
+			return out
+		}
+		out += fmt.Sprintf("HistoryStatus: <code>%s</code>\n", history.Status)
+		out += fmt.Sprintf("Health: <code>%.1f%%</code>\n", float64(history.Health)/10)
+		out += fmt.Sprintf("Par: <code>%s</code> | Unpack: <code>%s</code> | Move: <code>%s</code>", history.ParStatus, history.UnpackStatus, history.MoveStatus)
+		return out
+	}
+	out += fmt.Sprintf("GroupStatus: <code>%s</code>\n", group.Status)
+	out += fmt.Sprintf("Files: <code>%d</code> remaining of <code>%d</code> (<code>%d</code> par)\n", group.RemainingFileCount, group.FileCount, group.RemainingParCount)
+	out += fmt.Sprintf("Articles: <code>%d</code> ok, <code>%d</code> failed of <code>%d</code>\n", group.SuccessArticles, group.FailedArticles, group.TotalArticles)
+	out += fmt.Sprintf("Health: <code>%.1f%%</code> (critical <code>%.1f%%</code>)\n", float64(group.Health)/10, float64(group.CriticalHealth)/10)
+	out += fmt.Sprintf("ActiveDownloads: <code>%d</code>\n", group.ActiveDownloads)
+	out += fmt.Sprintf("DownloadTime: <code>%s</code>\n", utils.HumanizeDuration(time.Duration(group.DownloadTimeSec)*time.Second))
+	out += fmt.Sprintf("Par: <code>%s</code> | Unpack: <code>%s</code> | Move: <code>%s</code>", group.ParStatus, group.UnpackStatus, group.MoveStatus)
+	if group.PostInfoText != "" {
+		out += fmt.Sprintf("\nPostProcessing: <code>%s</code> (%.1f%%)", html.EscapeString(group.PostInfoText), float64(group.PostStageProgress)/10)
+	}
+	return out
+}
+
+// CancelMirror : pausing does not stop post-processing, groups that are past the download have it cancelled instead
 func (u *UsenetDownloadStatus) CancelMirror() bool {
 	u.isCancelled = true
-	dun, err := usenetClient.EditQueue("GroupPause", "", []int64{u.nzbID})
+	u.usenetDownloadListener.isCancelled = true
+	command := "GroupPause"
+	if isUsenetPostProcessing(u.GetStatus().Stage) {
+		command = "PostDelete"
+	}
+	dun, err := usenetClient.EditQueue(command, "", []int64{u.nzbID})
 	if err != nil {
 		L().Error(err)
 	}
@@ -355,8 +509,8 @@ func (u *UsenetDownloadStatus) CancelMirror() bool {
 }
 
 func NewUsenetDownload(filename string, link string, listener *MirrorListener) error {
-	if !isRPCConnected {
-		return fmt.Errorf("NZBGet RPC isnt connected atm.")
+	if err := usenetBackend.Ensure(); err != nil {
+		return err
 	}
 	L().Info(link)
 	reader, err := utils.GetReaderHandleByUrl(link)
@@ -373,12 +527,16 @@ func NewUsenetDownload(filename string, link string, listener *MirrorListener) e
 	if err != nil {
 		return err
 	}
+	return addUsenetDownload(filename, content, listener)
+}
+
+func addUsenetDownload(filename string, content []byte, listener *MirrorListener) error {
 	base64Encoded := base64.StdEncoding.EncodeToString(content)
 	if isUsenetDlExist(base64Encoded) {
 		return errors.New("this usenet download is already in queue, let the mirror finish and then add again")
 	}
 	dir := path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(listener.GetUid()))
-	err = os.MkdirAll(dir, 0755)
+	err := os.MkdirAll(dir, 0755)
 	if err != nil {
 		L().Errorf("NewUsenetDownload: os.MkdirAll: %s : %v", dir, err)
 		return err
@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	usenetFetchTimeout = 60 * time.Second
+	// usenetMaxNzbSize : nzb files of very large posts are a few MB, anything beyond this is not an nzb
+	usenetMaxNzbSize = 64 * 1024 * 1024
+)
+
+// newznabSearchFunctions : values of t= on newznab api links that return search results instead of an nzb
+var newznabSearchFunctions = map[string]bool{
+	"search":   true,
+	"tvsearch": true,
+	"movie":    true,
+	"music":    true,
+	"book":     true,
+}
+
+// newznabDownloadFunctions : values of t= on newznab api links that return the nzb itself
+var newznabDownloadFunctions = map[string]bool{
+	"get":    true,
+	"getnzb": true,
+}
+
+// IsUsenetLink : links to .nzb files, newznab api get and search links and the getnzb pages of newznab based indexers
+func IsUsenetLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if strings.HasSuffix(strings.ToLower(u.Path), ".nzb") || strings.Contains(u.Path, "/getnzb/") {
+		return true
+	}
+	function := strings.ToLower(u.Query().Get("t"))
+	return strings.HasSuffix(u.Path, "/api") && (newznabSearchFunctions[function] || newznabDownloadFunctions[function])
+}
+
+func isNewznabSearchLink(u *url.URL) bool {
+	return newznabSearchFunctions[strings.ToLower(u.Query().Get("t"))]
+}
+
+type newznabEnclosure struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type newznabItem struct {
+	Title     string           `xml:"title"`
+	Link      string           `xml:"link"`
+	Enclosure newznabEnclosure `xml:"enclosure"`
+}
+
+type newznabFeed struct {
+	Items []newznabItem `xml:"channel>item"`
+}
+
+// newznabError : what newznab apis send for bad keys, exhausted limits and missing items
+type newznabError struct {
+	XMLName     xml.Name `xml:"error"`
+	Code        string   `xml:"code,attr"`
+	Description string   `xml:"description,attr"`
+}
+
+func getNewznabError(content []byte) error {
+	var apiErr newznabError
+	if xml.Unmarshal(content, &apiErr) != nil || apiErr.Description == "" {
+		return nil
+	}
+	return fmt.Errorf("indexer error %s: %s", apiErr.Code, apiErr.Description)
+}
+
+// fetchUsenetLink : goes through the configured proxy and user agent like every other fetch, many indexers refuse go's own
+func fetchUsenetLink(link string, options *HTTPRequestOptions) (*http.Response, error) {
+	client := NewHTTPClientWithOptions(options, link)
+	client.Timeout = usenetFetchTimeout
+	res, err := client.Get(link)
+	if err != nil {
+		// url errors carry the link and with it the api key
+		return nil, fmt.Errorf("fetching %s failed: %s", utils.RedactCredentials(link), utils.RedactCredentials(err.Error()))
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("fetching %s failed: %s", utils.RedactCredentials(link), res.Status)
+	}
+	return res, nil
+}
+
+// resolveNewznabSearch : the first result of a search, indexers sort them newest first
+func resolveNewznabSearch(link string, options *HTTPRequestOptions) (string, string, error) {
+	res, err := fetchUsenetLink(link, options)
+	if err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+	content, err := readUsenetLink(res)
+	if err != nil {
+		return "", "", err
+	}
+	if apiErr := getNewznabError(content); apiErr != nil {
+		return "", "", apiErr
+	}
+	var feed newznabFeed
+	err = xml.Unmarshal(content, &feed)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse the search results: %v", err)
+	}
+	for _, item := range feed.Items {
+		nzbLink := item.Enclosure.URL
+		if nzbLink == "" {
+			nzbLink = item.Link
+		}
+		if nzbLink != "" {
+			return nzbLink, item.Title, nil
+		}
+	}
+	return "", "", fmt.Errorf("the search returned no results")
+}
+
+// readUsenetLink : reads one byte past the limit so that a body that does not fit is reported instead of cut off
+func readUsenetLink(res *http.Response) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(res.Body, usenetMaxNzbSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > usenetMaxNzbSize {
+		return nil, fmt.Errorf("%s is too large, nzb files are at most %s", res.Request.URL.Host, utils.GetHumanBytes(usenetMaxNzbSize))
+	}
+	return content, nil
+}
+
+// getNzbFilename : the name the indexer sends, otherwise the last path element of .nzb links
+func getNzbFilename(res *http.Response) string {
+	_, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition"))
+	if err == nil && params["filename"] != "" {
+		return path.Base(params["filename"])
+	}
+	base := path.Base(res.Request.URL.Path)
+	if strings.HasSuffix(strings.ToLower(base), ".nzb") {
+		return base
+	}
+	return ""
+}
+
+// fetchNzb : indexers answer bad api keys and exhausted limits with an error page and status 200, so the content is checked
+func fetchNzb(link string, options *HTTPRequestOptions) ([]byte, string, error) {
+	res, err := fetchUsenetLink(link, options)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	content, err := readUsenetLink(res)
+	if err != nil {
+		return nil, "", err
+	}
+	if !bytes.Contains(content, []byte("<nzb")) {
+		if apiErr := getNewznabError(content); apiErr != nil {
+			return nil, "", apiErr
+		}
+		return nil, "", fmt.Errorf("%s did not return an nzb file", utils.RedactCredentials(link))
+	}
+	return content, getNzbFilename(res), nil
+}
+
+// NewUsenetLinkDownload : search links download their first result, the nzb is fetched with the /mirror request options
+func NewUsenetLinkDownload(link string, requestOptions *HTTPRequestOptions, listener *MirrorListener) error {
+	if err := usenetBackend.Ensure(); err != nil {
+		return err
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	name := ""
+	if isNewznabSearchLink(u) {
+		link, name, err = resolveNewznabSearch(link, requestOptions)
+		if err != nil {
+			return err
+		}
+	}
+	content, filename, err := fetchNzb(link, requestOptions)
+	if err != nil {
+		return err
+	}
+	if filename == "" {
+		filename = sanitizeFileName(name, "download")
+	}
+	if !strings.HasSuffix(strings.ToLower(filename), ".nzb") {
+		filename += ".nzb"
+	}
+	return addUsenetDownload(filename, content, listener)
+}
@@ -0,0 +1,520 @@
+package engine
+
+import (
+	"MirrorBotGo/utils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// YtdlProbeTimeout : fetching the metadata of a large playlist can take a while
+const YtdlProbeTimeout = 2 * time.Minute
+
+const (
+	ytdlProgressPrefix = "ytdl-progress "
+	ytdlFilePrefix     = "ytdl-file "
+)
+
+type YtdlFormat struct {
+	FormatId string  `json:"format_id"`
+	Ext      string  `json:"ext"`
+	Height   int     `json:"height"`
+	Vcodec   string  `json:"vcodec"`
+	Acodec   string  `json:"acodec"`
+	Filesize float64 `json:"filesize"`
+}
+
+type YtdlEntry struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// YtdlInfo : the subset of yt-dlp -J output needed to offer formats, entries are only set for playlists
+type YtdlInfo struct {
+	Type      string        `json:"_type"`
+	Id        string        `json:"id"`
+	Title     string        `json:"title"`
+	Extractor string        `json:"extractor_key"`
+	Duration  float64       `json:"duration"`
+	Formats   []*YtdlFormat `json:"formats"`
+	Entries   []*YtdlEntry  `json:"entries"`
+}
+
+func (i *YtdlInfo) IsPlaylist() bool {
+	return i.Type == "playlist" || i.Type == "multi_video"
+}
+
+// YtdlFormatChoice : Selector is passed to yt-dlp -f as is
+type YtdlFormatChoice struct {
+	Label    string
+	Selector string
+}
+
+var ytdlPlaylistHeights = []int{1080, 720, 480, 360}
+
+const ytdlMaxHeightChoices = 6
+
+func ytdlBestChoice() *YtdlFormatChoice {
+	return &YtdlFormatChoice{Label: "Best", Selector: "bv*+ba/b"}
+}
+
+func ytdlAudioChoice() *YtdlFormatChoice {
+	return &YtdlFormatChoice{Label: "Audio only", Selector: "ba/b"}
+}
+
+func ytdlHeightChoice(height int) *YtdlFormatChoice {
+	return &YtdlFormatChoice{
+		Label:    fmt.Sprintf("%dp", height),
+		Selector: fmt.Sprintf("bv*[height<=%d]+ba/b[height<=%d]", height, height),
+	}
+}
+
+// GetYtdlFormatChoices : playlist entries are not probed one by one, so they get a fixed set of heights
+func GetYtdlFormatChoices(info *YtdlInfo) []*YtdlFormatChoice {
+	choices := []*YtdlFormatChoice{ytdlBestChoice()}
+	if info.IsPlaylist() {
+		for _, height := range ytdlPlaylistHeights {
+			choices = append(choices, ytdlHeightChoice(height))
+		}
+		return append(choices, ytdlAudioChoice())
+	}
+	seen := make(map[int]bool)
+	var heights []int
+	hasAudio := false
+	for _, format := range info.Formats {
+		if format.Acodec != "" && format.Acodec != "none" {
+			hasAudio = true
+		}
+		if format.Height > 0 && format.Vcodec != "none" && !seen[format.Height] {
+			seen[format.Height] = true
+			heights = append(heights, format.Height)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(heights)))
+	// the highest one is what best picks anyway
+	if len(heights) > 0 {
+		choices[0].Label = fmt.Sprintf("Best (%dp)", heights[0])
+		heights = heights[1:]
+	}
+	if len(heights) > ytdlMaxHeightChoices {
+		heights = heights[:ytdlMaxHeightChoices]
+	}
+	for _, height := range heights {
+		choices = append(choices, ytdlHeightChoice(height))
+	}
+	if hasAudio && len(info.Formats) > 1 {
+		choices = append(choices, ytdlAudioChoice())
+	}
+	return choices
+}
+
+// ParseYtdlQuality : best, audio or a height like 720 or 720p, lets --quality skip the keyboard
+func ParseYtdlQuality(quality string) (*YtdlFormatChoice, error) {
+	quality = strings.ToLower(strings.TrimSpace(quality))
+	switch quality {
+	case "best":
+		return ytdlBestChoice(), nil
+	case "audio":
+		return ytdlAudioChoice(), nil
+	}
+	height, err := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	if err != nil || height <= 0 {
+		return nil, fmt.Errorf("invalid quality %s, use best, audio or a height like 720", quality)
+	}
+	return ytdlHeightChoice(height), nil
+}
+
+// IsYtdlLink : matches the configured hosts and their subdomains
+func IsYtdlLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range utils.GetYtdlHosts() {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func getYtdlArgs(args ...string) []string {
+	if proxy := utils.GetHttpProxy(); proxy != "" {
+		args = append(args, "--proxy", proxy)
+	}
+	args = append(args, "--user-agent", utils.GetHttpUserAgent())
+	return append(args, utils.GetYtdlExtraArgs()...)
+}
+
+// getYtdlError : the last ERROR line yt-dlp printed, or the exit status if it printed none
+func getYtdlError(stderr string, err error) error {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], "ERROR:") {
+			return fmt.Errorf("yt-dlp: %s", strings.TrimSpace(strings.TrimPrefix(lines[i], "ERROR:")))
+		}
+	}
+	return fmt.Errorf("yt-dlp: %v", err)
+}
+
+// ProbeYtdl : playlists are listed flat, only single videos come with their formats
+func ProbeYtdl(link string) (*YtdlInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), YtdlProbeTimeout)
+	defer cancel()
+	args := getYtdlArgs("-J", "--flat-playlist", "--no-warnings")
+	args = append(args, "--", link)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, utils.GetYtdlPath(), args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("yt-dlp: timed out fetching media info")
+	}
+	if err != nil {
+		return nil, getYtdlError(stderr.String(), err)
+	}
+	var info YtdlInfo
+	err = json.Unmarshal(stdout.Bytes(), &info)
+	if err != nil {
+		return nil, fmt.Errorf("yt-dlp: failed to parse media info: %v", err)
+	}
+	if info.IsPlaylist() && len(info.Entries) == 0 {
+		return nil, fmt.Errorf("yt-dlp: playlist %s is empty", info.Title)
+	}
+	return &info, nil
+}
+
+// sanitizeFileName : turns a title into a single path element
+func sanitizeFileName(name string, fallback string) string {
+	name = strings.TrimSpace(strings.NewReplacer("/", "_", "\\", "_", "\x00", "").Replace(name))
+	if name == "" || name == "." || name == ".." {
+		return fallback
+	}
+	if len(name) > 150 {
+		name = strings.ToValidUTF8(name[:150], "")
+	}
+	return name
+}
+
+// YtdlDownload : runs yt-dlp once for the whole link, playlists end up as a directory named after the playlist
+type YtdlDownload struct {
+	link      string
+	info      *YtdlInfo
+	choice    *YtdlFormatChoice
+	name      string
+	filePath  string
+	mut       sync.Mutex
+	doneBytes int64
+	completed int64
+	total     int64
+	speed     int64
+	item      int64
+	itemsDone int64
+	ctx       context.Context
+	cancel    context.CancelFunc
+	listener  *MirrorListener
+	cancelled int32
+}
+
+func NewYtdlDownloadFromInfo(link string, info *YtdlInfo, choice *YtdlFormatChoice, listener *MirrorListener) *YtdlDownload {
+	y := &YtdlDownload{
+		link:     link,
+		info:     info,
+		choice:   choice,
+		name:     sanitizeFileName(info.Title, info.Id),
+		listener: listener,
+	}
+	y.ctx, y.cancel = context.WithCancel(context.Background())
+	return y
+}
+
+func (y *YtdlDownload) getDir() string {
+	return path.Join(utils.GetDownloadDir(), utils.ParseInt64ToString(y.listener.GetUid()))
+}
+
+func (y *YtdlDownload) getOutputTemplate() string {
+	if y.info.IsPlaylist() {
+		return path.Join(y.getDir(), y.name, "%(playlist_index)s - %(title).150B [%(id)s].%(ext)s")
+	}
+	return path.Join(y.getDir(), "%(title).150B [%(id)s].%(ext)s")
+}
+
+func (y *YtdlDownload) getArgs() []string {
+	args := getYtdlArgs(
+		"--newline", "--progress", "--no-mtime",
+		"--progress-template", "download:"+ytdlProgressPrefix+"%(progress.status)s %(progress.downloaded_bytes)s %(progress.total_bytes)s %(progress.total_bytes_estimate)s %(progress.speed)s %(info.playlist_index)s",
+		"--print", "after_move:"+ytdlFilePrefix+"%(filepath)s",
+		"-f", y.choice.Selector,
+		"-o", y.getOutputTemplate(),
+	)
+	if y.info.IsPlaylist() {
+		args = append(args, "--yes-playlist")
+	} else {
+		args = append(args, "--no-playlist")
+	}
+	return append(args, "--", y.link)
+}
+
+func parseYtdlNumber(field string) int64 {
+	n, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(n)
+}
+
+// onProgress : every stream of every item restarts the byte counters, finished streams are folded into doneBytes
+func (y *YtdlDownload) onProgress(line string) {
+	fields := strings.Fields(strings.TrimPrefix(line, ytdlProgressPrefix))
+	if len(fields) < 6 {
+		return
+	}
+	downloaded := parseYtdlNumber(fields[1])
+	total := parseYtdlNumber(fields[2])
+	if total == 0 {
+		total = parseYtdlNumber(fields[3])
+	}
+	y.mut.Lock()
+	defer y.mut.Unlock()
+	current := y.completed - y.doneBytes
+	if fields[0] == "finished" {
+		y.doneBytes += downloaded
+		current, total = 0, 0
+	} else {
+		if downloaded < current {
+			y.doneBytes += current
+		}
+		current = downloaded
+	}
+	if total < current {
+		total = current
+	}
+	y.completed = y.doneBytes + current
+	y.total = y.doneBytes + total
+	atomic.StoreInt64(&y.speed, parseYtdlNumber(fields[4]))
+	if item := parseYtdlNumber(fields[5]); item > 0 {
+		atomic.StoreInt64(&y.item, item)
+	}
+}
+
+func (y *YtdlDownload) onFile(line string) {
+	atomic.AddInt64(&y.itemsDone, 1)
+	if !y.info.IsPlaylist() {
+		y.mut.Lock()
+		y.filePath = strings.TrimPrefix(line, ytdlFilePrefix)
+		y.name = path.Base(y.filePath)
+		y.mut.Unlock()
+	}
+}
+
+func (y *YtdlDownload) run() error {
+	err := os.MkdirAll(y.getDir(), 0755)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(y.ctx, utils.GetYtdlPath(), y.getArgs()...)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("yt-dlp: %v", err)
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, ytdlProgressPrefix):
+			y.onProgress(line)
+		case strings.HasPrefix(line, ytdlFilePrefix):
+			y.onFile(line)
+		}
+	}
+	err = cmd.Wait()
+	if y.IsCancelled() {
+		return fmt.Errorf("download cancelled")
+	}
+	if err != nil {
+		return getYtdlError(stderr.String(), err)
+	}
+	if atomic.LoadInt64(&y.itemsDone) == 0 {
+		return fmt.Errorf("yt-dlp: nothing was downloaded")
+	}
+	return nil
+}
+
+func (y *YtdlDownload) Start() {
+	go func() {
+		defer y.cancel()
+		err := y.run()
+		if err != nil {
+			L().Errorf("[YtdlDownload] %s: %v", y.link, err)
+			y.listener.OnDownloadError(err.Error())
+			return
+		}
+		y.mut.Lock()
+		y.total = y.completed
+		y.mut.Unlock()
+		y.listener.OnDownloadComplete()
+	}()
+}
+
+func (y *YtdlDownload) Cancel() {
+	atomic.StoreInt32(&y.cancelled, 1)
+	y.cancel()
+}
+
+func (y *YtdlDownload) IsCancelled() bool {
+	return atomic.LoadInt32(&y.cancelled) == 1
+}
+
+func NewYtdlDownload(link string, info *YtdlInfo, choice *YtdlFormatChoice, listener *MirrorListener) error {
+	y := NewYtdlDownloadFromInfo(link, info, choice, listener)
+	status := NewYtdlDownloadStatus(y, utils.RandString(16))
+	status.Index_ = GenerateMirrorIndex()
+	AddMirrorLocal(listener.GetUid(), status)
+	listener.OnDownloadStart(status.Gid())
+	y.Start()
+	return nil
+}
+
+func NewYtdlDownloadStatus(y *YtdlDownload, gid string) *YtdlDownloadStatus {
+	return &YtdlDownloadStatus{
+		y:   y,
+		gid: gid,
+	}
+}
+
+type YtdlDownloadStatus struct {
+	y      *YtdlDownload
+	gid    string
+	Index_ int
+}
+
+func (s *YtdlDownloadStatus) Name() string {
+	s.y.mut.Lock()
+	defer s.y.mut.Unlock()
+	return s.y.name
+}
+
+func (s *YtdlDownloadStatus) CompletedLength() int64 {
+	s.y.mut.Lock()
+	defer s.y.mut.Unlock()
+	return s.y.completed
+}
+
+func (s *YtdlDownloadStatus) TotalLength() int64 {
+	s.y.mut.Lock()
+	defer s.y.mut.Unlock()
+	return s.y.total
+}
+
+func (s *YtdlDownloadStatus) Speed() int64 {
+	return atomic.LoadInt64(&s.y.speed)
+}
+
+func (s *YtdlDownloadStatus) ETA() *time.Duration {
+	if s.Speed() != 0 {
+		dur := utils.CalculateETA(s.TotalLength()-s.CompletedLength(), s.Speed())
+		return &dur
+	}
+	dur := time.Duration(0)
+	return &dur
+}
+
+func (s *YtdlDownloadStatus) Gid() string {
+	return s.gid
+}
+
+// Path : a single item is only known by its final name once yt-dlp has moved it into place
+func (s *YtdlDownloadStatus) Path() string {
+	s.y.mut.Lock()
+	defer s.y.mut.Unlock()
+	if s.y.filePath != "" {
+		return s.y.filePath
+	}
+	return path.Join(s.y.getDir(), s.y.name)
+}
+
+func (s *YtdlDownloadStatus) Percentage() float32 {
+	completed, total := s.CompletedLength(), s.TotalLength()
+	if total == 0 {
+		return float32(0)
+	}
+	return float32(completed*100) / float32(total)
+}
+
+func (s *YtdlDownloadStatus) GetStatusType() string {
+	if s.y.IsCancelled() {
+		return MirrorStatusCanceled
+	}
+	return MirrorStatusDownloading
+}
+
+func (s *YtdlDownloadStatus) IsTorrent() bool {
+	return false
+}
+
+func (s *YtdlDownloadStatus) PiecesCompleted() int {
+	return 0
+}
+
+func (s *YtdlDownloadStatus) PiecesTotal() int {
+	return 0
+}
+
+func (s *YtdlDownloadStatus) GetPeers() int {
+	return 0
+}
+
+func (s *YtdlDownloadStatus) GetSeeders() int {
+	return 0
+}
+
+func (s *YtdlDownloadStatus) Index() int {
+	return s.Index_
+}
+
+func (s *YtdlDownloadStatus) GetListener() *MirrorListener {
+	return s.y.listener
+}
+
+func (s *YtdlDownloadStatus) GetCloneListener() *CloneListener {
+	return nil
+}
+
+func (s *YtdlDownloadStatus) CancelMirror() bool {
+	s.y.Cancel()
+	return true
+}
+
+func (s *YtdlDownloadStatus) GetDetails() string {
+	out := fmt.Sprintf("<b>yt-dlp</b>: <code>%s</code>\n", html.EscapeString(s.y.info.Extractor))
+	out += fmt.Sprintf("Format: <code>%s</code>", s.y.choice.Label)
+	if s.y.info.IsPlaylist() {
+		out += fmt.Sprintf("\nItems: <code>%d/%d</code>", atomic.LoadInt64(&s.y.itemsDone), len(s.y.info.Entries))
+		if item := atomic.LoadInt64(&s.y.item); item > 0 {
+			out += fmt.Sprintf("\nCurrent: <code>#%d</code>", item)
+		}
+	}
+	return out
+}
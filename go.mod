@@ -12,12 +12,18 @@ require (
 	github.com/gotd/contrib v0.13.0
 	github.com/gotd/td v0.68.1
 	github.com/jaskaranSM/go-httpdl v0.0.0-20221204225223-2ddff92e7e68
+	github.com/jlaffaye/ftp v0.2.0
 	github.com/lithammer/shortuuid v3.0.0+incompatible
+	github.com/liut/kedge-go v0.0.0-20210922151147-e6641ba61642
 	github.com/mholt/archiver/v4 v4.0.0-alpha.7.0.20221122195607-f6e004e4bbc8
+	github.com/pkg/sftp v1.13.6
 	github.com/ricochet2200/go-disk-usage/du v0.0.0-20210707232629-ac9918953285
 	github.com/shirou/gopsutil/v3 v3.22.8
+	github.com/studio-b12/gowebdav v0.9.0
 	go.mongodb.org/mongo-driver v1.10.1
+	go.uber.org/ratelimit v0.2.0
 	go.uber.org/zap v1.23.0
+	golang.org/x/crypto v0.5.0
 	golang.org/x/time v0.0.0-20220722155302-e5dcc9cfc0b9
 	golift.io/nzbget v0.1.3
 	google.golang.org/api v0.94.0
@@ -85,8 +91,8 @@ require (
 	github.com/huandu/xstrings v1.3.2 // indirect
 	github.com/klauspost/compress v1.15.9 // indirect
 	github.com/klauspost/pgzip v1.2.5 // indirect
+	github.com/kr/fs v0.1.0 // indirect
 	github.com/lispad/go-generics-tools v1.1.0 // indirect
-	github.com/liut/kedge-go v0.0.0-20210922151147-e6641ba61642 // indirect
 	github.com/lufia/plan9stats v0.0.0-20211012122336-39d0f177ccd0 // indirect
 	github.com/montanaflynn/stats v0.6.6 // indirect
 	github.com/mschoch/smat v0.2.0 // indirect
@@ -130,9 +136,7 @@ require (
 	go.opentelemetry.io/otel/trace v1.9.0 // indirect
 	go.uber.org/atomic v1.10.0 // indirect
 	go.uber.org/multierr v1.8.0 // indirect
-	go.uber.org/ratelimit v0.2.0 // indirect
 	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
-	golang.org/x/crypto v0.5.0 // indirect
 	golang.org/x/exp v0.0.0-20220827204233-334a2380cb91 // indirect
 	golang.org/x/net v0.7.0 // indirect
 	golang.org/x/oauth2 v0.0.0-20220822191816-0ebed06d0094 // indirect
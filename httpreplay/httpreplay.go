@@ -0,0 +1,132 @@
+// Package httpreplay : records http exchanges as fixtures and replays them, kept free of the bot's config so it can be tested on its own
+package httpreplay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Fixture : one recorded request/response pair
+type Fixture struct {
+	Method  string            `bson:"method" json:"method"`
+	Url     string            `bson:"url" json:"url"`
+	Status  int               `bson:"status" json:"status"`
+	Headers map[string]string `bson:"headers" json:"headers"`
+	Body    string            `bson:"body" json:"body"`
+}
+
+// GetFixturesSize : bytes of response bodies, which is what makes up nearly all of a stored test case
+func GetFixturesSize(fixtures []Fixture) int64 {
+	var size int64
+	for _, fixture := range fixtures {
+		size += int64(len(fixture.Body))
+	}
+	return size
+}
+
+// ReplayTransport : serves recorded fixtures instead of hitting the network, unknown requests fail
+type ReplayTransport struct {
+	fixtures []Fixture
+	used     []bool
+	mut      sync.Mutex
+}
+
+func NewReplayTransport(fixtures []Fixture) *ReplayTransport {
+	return &ReplayTransport{
+		fixtures: fixtures,
+		used:     make([]bool, len(fixtures)),
+	}
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	match := -1
+	// prefer fixtures in recorded order, fall back to reusing one when a script repeats a request
+	for i, fixture := range t.fixtures {
+		if strings.EqualFold(fixture.Method, req.Method) && fixture.Url == req.URL.String() {
+			if !t.used[i] {
+				match = i
+				break
+			}
+			if match == -1 {
+				match = i
+			}
+		}
+	}
+	if match == -1 {
+		return nil, fmt.Errorf("no fixture recorded for %s %s", req.Method, req.URL.String())
+	}
+	t.used[match] = true
+	fixture := t.fixtures[match]
+	res := &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}
+	for k, v := range fixture.Headers {
+		res.Header.Set(k, v)
+	}
+	return res, nil
+}
+
+// RecordingTransport : performs the requests and keeps them as fixtures, bodies above maxBodySize fail the request
+// since they would have to be held in memory whole
+type RecordingTransport struct {
+	transport   http.RoundTripper
+	maxBodySize int64
+	fixtures    []Fixture
+	mut         sync.Mutex
+}
+
+func NewRecordingTransport(transport http.RoundTripper, maxBodySize int64) *RecordingTransport {
+	return &RecordingTransport{transport: transport, maxBodySize: maxBodySize}
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, t.maxBodySize+1))
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > t.maxBodySize {
+		return nil, fmt.Errorf("response from %s is above %d bytes, too large to record", req.URL.Host, t.maxBodySize)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	headers := make(map[string]string)
+	for key, value := range res.Header {
+		if len(value) > 0 {
+			headers[key] = value[0]
+		}
+	}
+	t.mut.Lock()
+	t.fixtures = append(t.fixtures, Fixture{
+		Method:  req.Method,
+		Url:     req.URL.String(),
+		Status:  res.StatusCode,
+		Headers: headers,
+		Body:    string(body),
+	})
+	t.mut.Unlock()
+	return res, nil
+}
+
+func (t *RecordingTransport) GetFixtures() []Fixture {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return append([]Fixture(nil), t.fixtures...)
+}
@@ -0,0 +1,104 @@
+package httpreplay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func get(t *testing.T, client *http.Client, url string) (int, string, string) {
+	t.Helper()
+	res, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return res.StatusCode, res.Header.Get("X-Test"), string(body)
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("X-Test", r.URL.Path)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		io.WriteString(w, "body of "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	recorder := NewRecordingTransport(http.DefaultTransport, 1024)
+	recordClient := &http.Client{Transport: recorder}
+	get(t, recordClient, server.URL+"/file")
+	get(t, recordClient, server.URL+"/missing")
+	fixtures := recorder.GetFixtures()
+	if len(fixtures) != 2 {
+		t.Fatalf("recorded %d fixtures, want 2", len(fixtures))
+	}
+	if got := GetFixturesSize(fixtures); got != int64(len("body of /file")+len("body of /missing")) {
+		t.Fatalf("fixtures size %d", got)
+	}
+
+	server.Close()
+	replayClient := &http.Client{Transport: NewReplayTransport(fixtures)}
+	status, header, body := get(t, replayClient, server.URL+"/file")
+	if status != http.StatusOK || header != "/file" || body != "body of /file" {
+		t.Fatalf("replayed /file as %d %q %q", status, header, body)
+	}
+	status, _, body = get(t, replayClient, server.URL+"/missing")
+	if status != http.StatusNotFound || body != "body of /missing" {
+		t.Fatalf("replayed /missing as %d %q", status, body)
+	}
+	if hits != 2 {
+		t.Fatalf("server was hit %d times, replay must not touch the network", hits)
+	}
+}
+
+func TestReplayOrderAndRepeats(t *testing.T) {
+	fixtures := []Fixture{
+		{Method: "GET", Url: "http://example.com/poll", Status: 200, Body: "pending"},
+		{Method: "GET", Url: "http://example.com/poll", Status: 200, Body: "ready"},
+	}
+	client := &http.Client{Transport: NewReplayTransport(fixtures)}
+	for _, want := range []string{"pending", "ready", "pending"} {
+		if _, _, body := get(t, client, "http://example.com/poll"); body != want {
+			t.Fatalf("got %q, want %q", body, want)
+		}
+	}
+}
+
+func TestReplayUnknownRequest(t *testing.T) {
+	client := &http.Client{Transport: NewReplayTransport(nil)}
+	res, err := client.Get("http://example.com/unknown")
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("request without a fixture succeeded")
+	}
+}
+
+func TestRecordBodyTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456789")
+	}))
+	defer server.Close()
+
+	recorder := NewRecordingTransport(http.DefaultTransport, 9)
+	res, err := (&http.Client{Transport: recorder}).Get(server.URL)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("recording a body above the limit succeeded")
+	}
+	if len(recorder.GetFixtures()) != 0 {
+		t.Fatal("a body above the limit was recorded")
+	}
+	recorder = NewRecordingTransport(http.DefaultTransport, 10)
+	if status, _, body := get(t, &http.Client{Transport: recorder}, server.URL); status != http.StatusOK || body != "0123456789" {
+		t.Fatalf("body at the limit recorded as %d %q", status, body)
+	}
+}
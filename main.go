@@ -8,6 +8,7 @@ import (
 	"MirrorBotGo/modules/cancelmirror"
 	"MirrorBotGo/modules/clone"
 	"MirrorBotGo/modules/configuration"
+	"MirrorBotGo/modules/info"
 	"MirrorBotGo/modules/list"
 	"MirrorBotGo/modules/mirror"
 	"MirrorBotGo/modules/mirrorstatus"
@@ -15,6 +16,7 @@ import (
 	"MirrorBotGo/modules/shell"
 	"MirrorBotGo/modules/start"
 	"MirrorBotGo/modules/stats"
+	"MirrorBotGo/modules/tgsession"
 	"MirrorBotGo/utils"
 	"net/http"
 	"os"
@@ -32,6 +34,7 @@ func ExitCleanup() {
 	killSignal := make(chan os.Signal, 1)
 	signal.Notify(killSignal, os.Interrupt)
 	<-killSignal
+	engine.KeepTelegramPartials()
 	engine.CancelAllMirrors()
 	engine.L().Info("Exit Cleanup")
 	err := utils.RemoveByPath(utils.GetDownloadDir())
@@ -54,11 +57,18 @@ func RegisterAllHandlers(updater *ext.Updater, l *zap.SugaredLogger) {
 	botlog.LoadLogHandler(updater, l)
 	shell.LoadShellHandlers(updater, l)
 	configuration.LoadConfigurationHandlers(updater, l)
+	info.LoadInfoHandler(updater, l)
+	tgsession.LoadTgSessionHandlers(updater, l)
 }
 
 func main() {
 	router := engine.NewHealthRouter()
 	router.StartWebServer(utils.GetHealthCheckRouterURL())
+	engine.StartBackendSupervisor()
+	engine.StartTelegramPartialSweeper()
+	if utils.GetTorrentUseTrackerList() {
+		engine.GetTrackerListCache().StartRefresher()
+	}
 	l := engine.GetLogger()
 	token := utils.GetBotToken()
 	l.Info("Starting Bot.")
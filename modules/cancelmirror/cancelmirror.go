@@ -13,6 +13,16 @@ import (
 	"go.uber.org/zap"
 )
 
+// isCancellable : usenet post-processing stages can be cancelled too, nzbget stops them with PostDelete
+func isCancellable(status string) bool {
+	switch status {
+	case engine.MirrorStatusDownloading, engine.MirrorStatusWaiting, engine.MirrorStatusFailed, engine.MirrorStatusCloning, engine.MirrorStatusSeeding, engine.MirrorStatusUploading,
+		engine.MirrorStatusVerifying, engine.MirrorStatusRepairing, engine.MirrorStatusUnpacking, engine.MirrorStatusPostProcessing:
+		return true
+	}
+	return false
+}
+
 func CancelMirrorHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	if !db.IsAuthorized(ctx.EffectiveMessage) {
 		return nil
@@ -36,7 +46,7 @@ func CancelMirrorHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	status := dl.GetStatusType()
-	if status == engine.MirrorStatusDownloading || status == engine.MirrorStatusWaiting || status == engine.MirrorStatusFailed || status == engine.MirrorStatusCloning || status == engine.MirrorStatusSeeding || status == engine.MirrorStatusUploading {
+	if isCancellable(status) {
 		dl.CancelMirror()
 	} else {
 		engine.SendMessage(b, "Can only cancel downloads/seeds/clones.", message)
@@ -57,7 +67,7 @@ func CancelAllMirrorsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	}
 	for _, dl := range engine.GetAllMirrors() {
 		status := dl.GetStatusType()
-		if status == engine.MirrorStatusDownloading || status == engine.MirrorStatusWaiting || status == engine.MirrorStatusFailed || status == engine.MirrorStatusCloning || status == engine.MirrorStatusSeeding || status == engine.MirrorStatusUploading {
+		if isCancellable(status) {
 			if dl.CancelMirror() {
 				count += 1
 			}
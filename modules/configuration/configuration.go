@@ -5,6 +5,8 @@ import (
 	"MirrorBotGo/engine"
 	"MirrorBotGo/utils"
 	"fmt"
+	"html"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +17,7 @@ import (
 	"go.uber.org/zap"
 )
 
+// SetGotdDownloadThreadsCountHandler : auto or 0 lets every download pick its own thread count again
 func SetGotdDownloadThreadsCountHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
 		return nil
@@ -22,22 +25,30 @@ func SetGotdDownloadThreadsCountHandler(b *gotgbot.Bot, ctx *ext.Context) error
 	message := ctx.EffectiveMessage
 	threadCountString := utils.ParseMessageArgs(message.Text)
 	if threadCountString == "" {
-		engine.SendMessage(b, "Provide arg bruh", message)
+		engine.SendMessage(b, "/setgotdthreads {count|auto}", message)
 		return nil
 	}
+	if strings.EqualFold(threadCountString, "auto") {
+		threadCountString = "0"
+	}
 	threadCountInt, err := strconv.Atoi(threadCountString)
 	if err != nil {
 		engine.L().Errorf("Error parsing gotd thread count: %s", err.Error())
 		engine.SendMessage(b, fmt.Sprintf("Error parsing thread count: %s", err.Error()), message)
+		return nil
 	}
-	if threadCountInt <= 0 {
-		engine.L().Errorf("Error setting gotd thread count: thread count must be above 0")
-		engine.SendMessage(b, "Error setting gotd thread count: thread count must be above 0", message)
+	if threadCountInt < 0 {
+		engine.L().Errorf("Error setting gotd thread count: thread count must not be negative")
+		engine.SendMessage(b, "Error setting gotd thread count: thread count must not be negative", message)
 		return nil
 	}
 	engine.L().Infof("Setting gotd download threads count %d", threadCountInt)
 	engine.SetGotdDownloadThreadsCount(threadCountInt)
-	engine.SendMessage(b, fmt.Sprintf("Gotd download threads count has been set to %d", threadCountInt), message) //engine.GetGotdDownloadThreadsCount()), message)
+	if threadCountInt == 0 {
+		engine.SendMessage(b, "Gotd download threads are now picked per download", message)
+		return nil
+	}
+	engine.SendMessage(b, fmt.Sprintf("Gotd download threads count has been set to %d", threadCountInt), message)
 	return nil
 }
 
@@ -46,7 +57,7 @@ func GetGotdDownloadThreadsCountHandler(b *gotgbot.Bot, ctx *ext.Context) error
 		return nil
 	}
 	message := ctx.EffectiveMessage
-	engine.SendMessage(b, fmt.Sprintf("Gotd download thread count: <code>%d</code>", engine.GetGotdDownloadThreadsCount()), message)
+	engine.SendMessage(b, engine.GetGotdThreadsString(), message)
 	return nil
 }
 
@@ -86,7 +97,7 @@ func GetMirrorMessageHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		mirrorMessage = cloneListener.Update.Message
 	}
 	out := ""
-	out += fmt.Sprintf("MessageText: <code>%s</code>\n", mirrorMessage.Text)
+	out += fmt.Sprintf("MessageText: <code>%s</code>\n", html.EscapeString(utils.RedactCredentials(mirrorMessage.Text)))
 	out += fmt.Sprintf("FromName: <code>%s %s</code>\n", mirrorMessage.From.FirstName, mirrorMessage.From.LastName)
 	out += fmt.Sprintf("FromID: <code>%d</code>\n", mirrorMessage.From.Id)
 	if mirrorMessage.From.Username != "" {
@@ -131,7 +142,7 @@ func AddDDLScriptHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	script := data[1]
-	err := db.UpdateExtractor(regex, script)
+	err := db.UpdateExtractor(regex, script, ctx.EffectiveUser)
 	if err != nil {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
@@ -151,13 +162,21 @@ func GetAllDDLsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
 	}
-	for k, _ := range extractors {
-		out += fmt.Sprintf("<code>%s</code>\n", k)
+	for _, extractor := range extractors {
+		out += fmt.Sprintf("<code>%s</code> (priority %d)\n", extractor.Regex, extractor.Priority)
 	}
-	if out == "" {
-		engine.SendMessage(b, "no extractor found", message)
+	disabled, err := db.GetDisabledExtractors()
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
 		return nil
 	}
+	for _, k := range disabled {
+		out += fmt.Sprintf("<code>%s</code> (disabled)\n", k)
+	}
+	if out == "" {
+		out = "no extractor found\n"
+	}
+	out = "Scripts:\n" + out + "\nNative resolvers:\n" + engine.GetResolversInfoString()
 	engine.SendMessage(b, out, message)
 	return nil
 }
@@ -172,16 +191,12 @@ func GetDLLCodeByRegexHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		engine.SendMessage(b, "/cmd {regex}", message)
 		return nil
 	}
-	extractors, err := db.GetExtractors()
+	extractor, err := db.GetExtractor(regex)
 	if err != nil {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
 	}
-	script, ok := extractors[regex]
-	if !ok {
-		engine.SendMessage(b, "extractor not found", message)
-		return nil
-	}
+	script := extractor.Script
 	engine.SendMessage(b, fmt.Sprintf("<code>%s</code>", script), message)
 	return nil
 }
@@ -197,7 +212,7 @@ func RemoveDDLHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	regex := args[1]
-	err := db.RemoveExtractor(regex)
+	err := db.RemoveExtractor(regex, ctx.EffectiveUser)
 	if err != nil {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
@@ -206,6 +221,170 @@ func RemoveDDLHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
+func parseVersionArgs(ctx *ext.Context) (string, int, bool) {
+	args := ctx.Args()
+	if len(args) < 3 {
+		return "", 0, false
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(args[2], "v"))
+	if err != nil {
+		return "", 0, false
+	}
+	return args[1], version, true
+}
+
+func sendVersionHistory(b *gotgbot.Bot, message *gotgbot.Message, kind string, name string) {
+	versions, err := db.GetVersions(kind, name)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return
+	}
+	if len(versions) == 0 {
+		engine.SendMessage(b, fmt.Sprintf("no versions recorded for %s %s", kind, name), message)
+		return
+	}
+	out := fmt.Sprintf("Versions of %s <code>%s</code>:\n\n", kind, html.EscapeString(name))
+	for _, version := range versions {
+		out += html.EscapeString(version.Summary()) + "\n"
+	}
+	engine.SendMessage(b, out, message)
+}
+
+func ScriptVersionsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	regex := utils.ParseMessageArgs(message.Text)
+	if regex == "" {
+		engine.SendMessage(b, "/cmd {regex}", message)
+		return nil
+	}
+	sendVersionHistory(b, message, db.VersionKindExtractor, regex)
+	return nil
+}
+
+func ScriptDiffHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	regex, number, ok := parseVersionArgs(ctx)
+	if !ok {
+		engine.SendMessage(b, "/cmd {regex} {version}", message)
+		return nil
+	}
+	version, err := db.GetVersion(db.VersionKindExtractor, regex, number)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	if version.Diff == "" {
+		engine.SendMessage(b, fmt.Sprintf("%s\n\nno changes to the script", html.EscapeString(version.Summary())), message)
+		return nil
+	}
+	out := fmt.Sprintf("%s\n\n<code>%s</code>", html.EscapeString(version.Summary()), html.EscapeString(version.Diff))
+	if len(out) <= 4000 {
+		engine.SendMessage(b, out, message)
+		return nil
+	}
+	_, err = b.SendDocument(message.Chat.Id, gotgbot.NamedFile{
+		File:     strings.NewReader(version.Diff),
+		FileName: fmt.Sprintf("v%d.diff", version.Version),
+	}, &gotgbot.SendDocumentOpts{
+		ReplyToMessageId: message.MessageId,
+		Caption:          version.Summary(),
+	})
+	if err != nil {
+		engine.L().Errorf("ScriptDiffHandler: SendDocument: %v", err)
+		engine.SendMessage(b, fmt.Sprintf("Error while sending diff: %s", err.Error()), message)
+	}
+	return nil
+}
+
+func RollbackScriptHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	regex, number, ok := parseVersionArgs(ctx)
+	if !ok {
+		engine.SendMessage(b, "/cmd {regex} {version}", message)
+		return nil
+	}
+	err := db.RollbackExtractor(regex, number, ctx.EffectiveUser)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, fmt.Sprintf("script with regex %s has been rolled back to v%d", regex, number), message)
+	return nil
+}
+
+func setScriptDisabled(b *gotgbot.Bot, ctx *ext.Context, disabled bool) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	regex := utils.ParseMessageArgs(message.Text)
+	if regex == "" {
+		engine.SendMessage(b, "/cmd {regex}", message)
+		return nil
+	}
+	err := db.SetExtractorDisabled(regex, disabled, ctx.EffectiveUser)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	state := "enabled"
+	if disabled {
+		state = "disabled"
+	}
+	engine.SendMessage(b, fmt.Sprintf("script with regex %s has been %s", regex, state), message)
+	return nil
+}
+
+func DisableScriptHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	return setScriptDisabled(b, ctx, true)
+}
+
+func EnableScriptHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	return setScriptDisabled(b, ctx, false)
+}
+
+func SecretVersionsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	key := utils.ParseMessageArgs(message.Text)
+	if key == "" {
+		engine.SendMessage(b, "/cmd {secret}", message)
+		return nil
+	}
+	sendVersionHistory(b, message, db.VersionKindSecret, key)
+	return nil
+}
+
+func RollbackSecretHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	key, number, ok := parseVersionArgs(ctx)
+	if !ok {
+		engine.SendMessage(b, "/cmd {secret} {version}", message)
+		return nil
+	}
+	err := db.RollbackSecret(key, number, ctx.EffectiveUser)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, fmt.Sprintf("secret with key %s has been rolled back to v%d", key, number), message)
+	return nil
+}
+
 func AddSecretHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
 		return nil
@@ -223,12 +402,17 @@ func AddSecretHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	secret := strings.SplitN(args[1], "=", 2)
 	secretKey := secret[0]
 	secretValue := secret[1]
-	err := db.UpdateSecret(secretKey, secretValue)
+	err := db.UpdateSecret(secretKey, secretValue, ctx.EffectiveUser)
 	if err != nil {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
 	}
-	engine.SendMessage(b, fmt.Sprintf("secret with key %s has been added", secretKey), message)
+	// the command itself carries the value in plaintext, don't leave it in the chat
+	_, err = b.DeleteMessage(message.Chat.Id, message.MessageId, nil)
+	if err != nil {
+		engine.L().Warnf("AddSecretHandler: failed to delete command message: %v", err)
+	}
+	engine.SendMessageToChat(b, fmt.Sprintf("secret with key <code>%s</code> has been added", html.EscapeString(secretKey)), message)
 	return nil
 }
 
@@ -243,7 +427,7 @@ func RemoveSecretHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	secretKey := args[1]
-	err := db.RemoveSecret(secretKey)
+	err := db.RemoveSecret(secretKey, ctx.EffectiveUser)
 	if err != nil {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
@@ -263,8 +447,31 @@ func GetAllSecretsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
 	}
-	for k, v := range secrets {
-		out += fmt.Sprintf("<code>%s=%s</code>\n", k, v)
+	extractors, err := db.GetExtractors()
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	usedBy := make(map[string][]string)
+	for _, extractor := range extractors {
+		for _, key := range engine.GetDeclaredSecrets(extractor.Script) {
+			usedBy[key] = append(usedBy[key], extractor.Regex)
+		}
+	}
+	keys := make([]string, 0, len(secrets))
+	for k := range secrets {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out += fmt.Sprintf("<code>%s</code> = %s\n", html.EscapeString(k), utils.MaskSecret(secrets[k]))
+		if len(usedBy[k]) == 0 {
+			out += "   not declared by any script\n"
+			continue
+		}
+		for _, regex := range usedBy[k] {
+			out += fmt.Sprintf("   used by <code>%s</code>\n", html.EscapeString(regex))
+		}
 	}
 	if out == "" {
 		engine.SendMessage(b, "no secret found", message)
@@ -294,12 +501,206 @@ func GetLinkHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 		engine.SendMessage(b, err.Error(), message)
 		return nil
 	}
-	ddl, err := engine.ExtractDDL(link, extractors, secrets, b, ctx)
+	result, err := engine.ExtractDDLResult(link, extractors, secrets, b, ctx)
 	if err != nil {
 		engine.SendMessage(b, fmt.Sprintf("extraction failed: %v", err), message)
 		return nil
 	}
-	engine.SendMessage(b, ddl, message)
+	engine.SendMessage(b, result.String(), message)
+	return nil
+}
+
+func TestScriptHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	regex := utils.ParseMessageArgs(message.Text)
+	if regex == "" {
+		engine.SendMessage(b, "/cmd {regex}", message)
+		return nil
+	}
+	extractor, err := db.GetExtractor(regex)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	script := extractor.Script
+	tests, err := db.GetExtractorTests(regex)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	if len(tests) == 0 {
+		engine.SendMessage(b, "no test cases stored for this extractor, add one with /addscripttest", message)
+		return nil
+	}
+	secrets, err := db.GetSecrets()
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	var results []*engine.ScriptTestResult
+	for _, testCase := range tests {
+		results = append(results, engine.RunScriptTest(script, secrets, testCase, b, ctx))
+	}
+	engine.SendMessage(b, engine.GetScriptTestReport(regex, results), message)
+	return nil
+}
+
+func AddScriptTestHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	args := ctx.Args()
+	if len(args) < 3 {
+		engine.SendMessage(b, "/cmd {regex} {link} [name]", message)
+		return nil
+	}
+	regex := args[1]
+	link := args[2]
+	name := link
+	if len(args) > 3 {
+		name = strings.Join(args[3:], " ")
+	}
+	extractor, err := db.GetExtractor(regex)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	script := extractor.Script
+	secrets, err := db.GetSecrets()
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	testCase, err := engine.RecordScriptTest(name, link, script, secrets, b, ctx)
+	if err != nil {
+		engine.SendMessage(b, fmt.Sprintf("recording failed: %v", err), message)
+		return nil
+	}
+	err = db.AddExtractorTest(regex, testCase)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, fmt.Sprintf("test case recorded with %d fixtures, expected: <code>%s</code>", len(testCase.Fixtures), html.EscapeString(testCase.Expected)), message)
+	return nil
+}
+
+func ClearScriptTestsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	regex := utils.ParseMessageArgs(message.Text)
+	if regex == "" {
+		engine.SendMessage(b, "/cmd {regex}", message)
+		return nil
+	}
+	err := db.ClearExtractorTests(regex)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, fmt.Sprintf("test cases of script with regex %s have been removed", regex), message)
+	return nil
+}
+
+func SetScriptPriorityHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	args := ctx.Args()
+	if len(args) < 3 {
+		engine.SendMessage(b, "/cmd {regex} {priority}", message)
+		return nil
+	}
+	priority, err := strconv.Atoi(args[2])
+	if err != nil {
+		engine.SendMessage(b, "priority must be an integer", message)
+		return nil
+	}
+	err = db.SetExtractorPriority(args[1], priority)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, fmt.Sprintf("priority of script with regex %s has been set to %d", args[1], priority), message)
+	return nil
+}
+
+// ScriptOverlapsHandler : checks the stored test links plus any links given as arguments against every extractor
+func ScriptOverlapsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	extractors, err := db.GetExtractors()
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	links := ctx.Args()[1:]
+	for _, extractor := range extractors {
+		tests, err := db.GetExtractorTests(extractor.Regex)
+		if err != nil {
+			engine.L().Errorf("ScriptOverlapsHandler: %s: %v", extractor.Regex, err)
+			continue
+		}
+		for _, testCase := range tests {
+			links = append(links, testCase.Link)
+		}
+	}
+	if len(links) == 0 {
+		engine.SendMessage(b, "no sample links, pass some as arguments or record tests with /addscripttest", message)
+		return nil
+	}
+	overlaps := engine.FindExtractorOverlaps(extractors, links)
+	engine.SendMessage(b, engine.GetExtractorOverlapReport(overlaps, len(links)), message)
+	return nil
+}
+
+func TrackerListHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	cache := engine.GetTrackerListCache()
+	out := ""
+	switch utils.ParseMessageArgs(message.Text) {
+	case "refresh":
+		_, err := cache.Refresh()
+		if err != nil {
+			out += fmt.Sprintf("Refresh failed, keeping cached list: <code>%s</code>\n\n", html.EscapeString(err.Error()))
+		} else {
+			out += "Tracker list refreshed.\n\n"
+		}
+		out += cache.GetInfoString()
+	case "list":
+		trackers := cache.GetCachedTrackers()
+		if len(trackers) == 0 {
+			out = "Tracker list cache is empty."
+			break
+		}
+		_, err := b.SendDocument(message.Chat.Id, gotgbot.NamedFile{
+			File:     strings.NewReader(strings.Join(trackers, "\n")),
+			FileName: "trackers.txt",
+		}, &gotgbot.SendDocumentOpts{
+			ReplyToMessageId: message.MessageId,
+		})
+		if err != nil {
+			engine.L().Errorf("TrackerListHandler: SendDocument: %v", err)
+			out = fmt.Sprintf("Error while sending tracker list: %s", html.EscapeString(err.Error()))
+			break
+		}
+		return nil
+	default:
+		out = cache.GetInfoString()
+	}
+	engine.SendMessage(b, out, message)
 	return nil
 }
 
@@ -313,8 +714,21 @@ func LoadConfigurationHandlers(updater *ext.Updater, l *zap.SugaredLogger) {
 	updater.Dispatcher.AddHandler(handlers.NewCommand("removescript", RemoveDDLHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("getallscripts", GetAllDDLsHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("getscript", GetDLLCodeByRegexHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("scriptversions", ScriptVersionsHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("scriptdiff", ScriptDiffHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("rollbackscript", RollbackScriptHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("disablescript", DisableScriptHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("enablescript", EnableScriptHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("setscriptpriority", SetScriptPriorityHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("scriptoverlaps", ScriptOverlapsHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("addsecret", AddSecretHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("removesecret", RemoveSecretHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("getsecrets", GetAllSecretsHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("secretversions", SecretVersionsHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("rollbacksecret", RollbackSecretHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("getlink", GetLinkHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("testscript", TestScriptHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("addscripttest", AddScriptTestHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("clearscripttests", ClearScriptTestsHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("trackers", TrackerListHandler))
 }
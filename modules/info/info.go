@@ -0,0 +1,41 @@
+package info
+
+import (
+	"MirrorBotGo/db"
+	"MirrorBotGo/engine"
+	"MirrorBotGo/utils"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"go.uber.org/zap"
+)
+
+func InfoHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !db.IsAuthorized(ctx.EffectiveMessage) {
+		return nil
+	}
+	var dl engine.MirrorStatus
+	message := ctx.EffectiveMessage
+	gid := utils.ParseMessageArgs(message.Text)
+	if message.ReplyToMessage == nil && gid == "" {
+		engine.SendMessage(b, "Reply to mirror start message or provide gid to get its info.", message)
+		return nil
+	}
+	if gid != "" {
+		dl = engine.GetMirrorByGid(gid)
+	} else {
+		dl = engine.GetMirrorByUid(message.ReplyToMessage.MessageId)
+	}
+	if dl == nil {
+		engine.SendMessage(b, "Mirror doesnt exists.", message)
+		return nil
+	}
+	engine.SendMessage(b, engine.GetMirrorInfoString(dl), message)
+	return nil
+}
+
+func LoadInfoHandler(updater *ext.Updater, l *zap.SugaredLogger) {
+	defer l.Info("Info Module Loaded.")
+	updater.Dispatcher.AddHandler(handlers.NewCommand("info", InfoHandler))
+}
@@ -4,7 +4,9 @@ import (
 	"MirrorBotGo/db"
 	"MirrorBotGo/engine"
 	"MirrorBotGo/utils"
+	"errors"
 	"fmt"
+	"html"
 	"strings"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -13,23 +15,31 @@ import (
 	"go.uber.org/zap"
 )
 
-func extract(link string, b *gotgbot.Bot, ctx *ext.Context) (string, error) {
-	if !db.IsExtractable(link) {
-		return "", fmt.Errorf("link is not extractable")
+// extract : native resolvers first, then js extractors, then the generic page resolver,
+// the resolvers use the request options of the mirror, js extractors make their own requests from the sandbox,
+// the resolver is returned when one claimed the link so that its errors can be told apart
+func extract(link string, requestOptions *engine.HTTPRequestOptions, b *gotgbot.Bot, ctx *ext.Context) (*engine.ExtractResult, engine.Resolver, error) {
+	result, resolver, err := engine.ResolveNative(link, requestOptions)
+	if resolver != nil {
+		return result, resolver, err
 	}
-	extractors, err := db.GetExtractors()
-	if err != nil {
-		return "", err
+	if db.IsExtractable(link) {
+		extractors, err := db.GetExtractors()
+		if err != nil {
+			return nil, nil, err
+		}
+		secrets, err := db.GetSecrets()
+		if err != nil {
+			return nil, nil, err
+		}
+		result, err := engine.ExtractDDLResult(link, extractors, secrets, b, ctx)
+		return result, nil, err
 	}
-	secrets, err := db.GetSecrets()
-	if err != nil {
-		return "", err
+	result, resolver, err = engine.ResolveFallback(link, requestOptions)
+	if resolver != nil {
+		return result, resolver, err
 	}
-	newLink, err := engine.ExtractDDL(link, extractors, secrets, b, ctx)
-	if err != nil {
-		return "", err
-	}
-	return newLink, nil
+	return nil, nil, fmt.Errorf("link is not extractable")
 }
 
 type PrepareMirrorOptions struct {
@@ -63,6 +73,8 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 		isTorrent bool
 	)
 
+	_, options := utils.ParseMessageOptions(utils.ParseMessageArgs(opts.Message.Text))
+
 	result, err := prepareTgDownload(opts)
 	if err != nil {
 		engine.SendMessage(opts.B, err.Error(), opts.Message)
@@ -72,6 +84,7 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 	link = result.Link
 	listener := engine.NewMirrorListener(opts.B, opts.Ctx, opts.IsTar, opts.DoUnArchive, parentId)
 	if result.IsUsenetDownload {
+		listener.SetSource(engine.MirrorSourceUsenet, result.NzbFileName)
 		err := engine.NewUsenetDownload(result.NzbFileName, link, &listener)
 		if err != nil {
 			engine.SendMessage(opts.B, err.Error(), opts.Message)
@@ -84,6 +97,7 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 	}
 
 	if result.IsTgDownload {
+		listener.SetSource(engine.MirrorSourceTelegram, opts.Message.ReplyToMessage.GetLink())
 		err := engine.NewTelegramDownload(opts.Message.ReplyToMessage, &listener)
 		if err != nil {
 			engine.SendMessage(opts.B, err.Error(), opts.Message)
@@ -99,16 +113,75 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 		opts.Message.Text = fmt.Sprintf("/mirror %s", result.Link) //TODO: find better way to handle this case
 	}
 
-	link = utils.ParseMessageArgs(opts.Message.Text)
-	engine.L().Info(link)
-	newLink, err := extract(link, opts.B, opts.Ctx)
+	link, _ = utils.ParseMessageOptions(utils.ParseMessageArgs(opts.Message.Text))
+	link, requestOptions, err := engine.NewHTTPRequestOptionsFromMessage(link, options)
+	if err != nil {
+		engine.SendMessage(opts.B, err.Error(), opts.Message)
+		return nil
+	}
+	engine.L().Info(utils.RedactCredentials(link))
+	if engine.IsTelegramMessageLink(link) {
+		listener.SetSource(engine.MirrorSourceTelegram, link)
+		err := engine.NewTelegramLinkDownload(link, &listener)
+		if err != nil {
+			engine.SendMessage(opts.B, err.Error(), opts.Message)
+			return nil
+		}
+		defer func() {
+			HandleSendStatusMessage(opts)
+		}()
+		return nil
+	}
+	if engine.IsRemoteFsLink(link) {
+		listener.SetSource(engine.GetRemoteFsSource(link), utils.RedactCredentials(link))
+		secrets, err := db.GetSecrets()
+		if err != nil {
+			engine.SendMessage(opts.B, err.Error(), opts.Message)
+			return nil
+		}
+		err = engine.NewRemoteDownload(link, &listener, secrets)
+		if err != nil {
+			engine.SendMessage(opts.B, utils.RedactCredentials(err.Error()), opts.Message)
+			return nil
+		}
+		defer func() {
+			HandleSendStatusMessage(opts)
+		}()
+		return nil
+	}
+	// --nzb forces links that do not look like nzb files or indexer links
+	if _, ok := options["nzb"]; ok || engine.IsUsenetLink(link) {
+		listener.SetSource(engine.MirrorSourceUsenet, utils.RedactCredentials(link))
+		err := engine.NewUsenetLinkDownload(link, requestOptions, &listener)
+		if err != nil {
+			engine.SendMessage(opts.B, err.Error(), opts.Message)
+			return nil
+		}
+		defer func() {
+			HandleSendStatusMessage(opts)
+		}()
+		return nil
+	}
+	// --ytdl forces yt-dlp for hosts that are not configured
+	if _, ok := options["ytdl"]; ok || engine.IsYtdlLink(link) {
+		return prepareYtdl(opts, &listener, link, options)
+	}
+	sourceLink := link
+	extracted, resolver, err := extract(link, requestOptions, opts.B, opts.Ctx)
+	// a resolver that claimed the link knows why it failed, downloading the page instead would only hide that
+	if err != nil && resolver != nil && !errors.Is(err, engine.ErrNotResolvable) {
+		engine.SendMessage(opts.B, fmt.Sprintf("%s: %s", resolver.Name(), html.EscapeString(err.Error())), opts.Message)
+		return nil
+	}
 	if err != nil {
 		engine.L().Infof("Failed to extract ddl even: %v", err)
 	} else {
-		link = newLink
+		link = extracted.Url
+		requestOptions = requestOptions.Merge(engine.NewHTTPRequestOptionsFromExtractResult(extracted))
 	}
 	fileId := utils.GetFileIdByGDriveLink(link)
 	if fileId != "" {
+		listener.SetSource(engine.MirrorSourceGoogleDrive, sourceLink)
 		engine.NewGDriveDownloadTransferService(fileId, &listener)
 		defer func() {
 			HandleSendStatusMessage(opts)
@@ -116,6 +189,7 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 		return nil
 	}
 	if utils.IsMegaLink(link) {
+		listener.SetSource(engine.MirrorSourceMega, sourceLink)
 		err := engine.NewMegaDownload(link, &listener)
 		if err != nil {
 			engine.SendMessage(opts.B, err.Error(), opts.Message)
@@ -134,7 +208,16 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 	isTorrent, _ = utils.IsTorrentLink(link)
 
 	if utils.IsMagnetLink(link) || isTorrent {
-		err := engine.NewKedgeDownload(link, &listener, opts.Seed)
+		listener.SetSource(engine.MirrorSourceTorrent, sourceLink)
+		if opts.Seed {
+			policy, err := engine.NewSeedPolicyFromOptions(options)
+			if err != nil {
+				engine.SendMessage(opts.B, err.Error(), opts.Message)
+				return nil
+			}
+			listener.SetSeedPolicy(policy)
+		}
+		err := engine.NewTorrentDownload(link, &listener, opts.Seed)
 		if err != nil {
 			engine.SendMessage(opts.B, err.Error(), opts.Message)
 			return nil
@@ -143,7 +226,8 @@ func PrepareMirror(opts *PrepareMirrorOptions) error {
 			HandleSendStatusMessage(opts)
 		}()
 	} else {
-		err := engine.NewHTTPDownload(link, &listener)
+		listener.SetSource(engine.MirrorSourceHTTP, sourceLink)
+		err := engine.NewHTTPDownload(link, &listener, requestOptions)
 		if err != nil {
 			engine.SendMessage(opts.B, err.Error(), opts.Message)
 			return nil
@@ -191,7 +275,12 @@ func prepareTgDownload(opts *PrepareMirrorOptions) (TgDownloadDetectionResult, e
 				result.IsTgDownload = true
 			}
 		}
-		if opts.Message.ReplyToMessage.Audio != nil || opts.Message.ReplyToMessage.Video != nil {
+		reply := opts.Message.ReplyToMessage
+		if reply.Audio != nil || reply.Video != nil || len(reply.Photo) > 0 || reply.Voice != nil || reply.VideoNote != nil || reply.Animation != nil || reply.Sticker != nil {
+			result.IsTgDownload = true
+		}
+		// the whole album is downloaded, whichever of its messages was replied to
+		if opts.Message.ReplyToMessage.MediaGroupId != "" && !result.IsTorrent && !result.IsUsenetDownload {
 			result.IsTgDownload = true
 		}
 	}
@@ -315,5 +404,8 @@ func LoadMirrorHandlers(updater *ext.Updater, l *zap.SugaredLogger) {
 
 	updater.Dispatcher.AddHandler(handlers.NewCommand("seedtorrent", SeedTorrentHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("seedtorrents", SilentSeedTorrentHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCallback(func(cq *gotgbot.CallbackQuery) bool {
+		return strings.HasPrefix(cq.Data, ytdlCallbackPrefix)
+	}, YtdlFormatHandler))
 
 }
@@ -0,0 +1,170 @@
+package mirror
+
+import (
+	"MirrorBotGo/engine"
+	"MirrorBotGo/utils"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// ytdlSelectionTimeout : format keyboards nobody answered are dropped after this long
+const ytdlSelectionTimeout = 2 * time.Minute
+
+const ytdlCallbackPrefix = "ytdl_"
+
+// ytdlSelection : a probed link waiting for its requester to pick a format
+type ytdlSelection struct {
+	opts     *PrepareMirrorOptions
+	listener *engine.MirrorListener
+	link     string
+	info     *engine.YtdlInfo
+	choices  []*engine.YtdlFormatChoice
+	userId   int64
+	message  *gotgbot.Message
+	timer    *time.Timer
+}
+
+var ytdlSelections = make(map[string]*ytdlSelection)
+var ytdlSelectionsMut sync.Mutex
+
+func popYtdlSelection(id string) *ytdlSelection {
+	ytdlSelectionsMut.Lock()
+	defer ytdlSelectionsMut.Unlock()
+	selection, ok := ytdlSelections[id]
+	if !ok {
+		return nil
+	}
+	delete(ytdlSelections, id)
+	selection.timer.Stop()
+	return selection
+}
+
+func getYtdlMediaString(info *engine.YtdlInfo) string {
+	out := fmt.Sprintf("<b>%s</b>\n", html.EscapeString(info.Title))
+	out += fmt.Sprintf("Site: <code>%s</code>\n", html.EscapeString(info.Extractor))
+	if info.IsPlaylist() {
+		out += fmt.Sprintf("Playlist: <code>%d items</code>\n", len(info.Entries))
+	} else if info.Duration > 0 {
+		out += fmt.Sprintf("Duration: <code>%s</code>\n", time.Duration(info.Duration)*time.Second)
+	}
+	return out
+}
+
+func getYtdlFormatMarkup(id string, choices []*engine.YtdlFormatChoice) gotgbot.InlineKeyboardMarkup {
+	var markup gotgbot.InlineKeyboardMarkup
+	var row []gotgbot.InlineKeyboardButton
+	for i, choice := range choices {
+		row = append(row, engine.NewKeyboardButtonText(choice.Label, fmt.Sprintf("%s%s_%d", ytdlCallbackPrefix, id, i)))
+		if len(row) == 3 {
+			markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		markup.InlineKeyboard = append(markup.InlineKeyboard, row)
+	}
+	markup.InlineKeyboard = append(markup.InlineKeyboard, []gotgbot.InlineKeyboardButton{
+		engine.NewKeyboardButtonText("Cancel", fmt.Sprintf("%s%s_cancel", ytdlCallbackPrefix, id)),
+	})
+	return markup
+}
+
+func startYtdl(opts *PrepareMirrorOptions, listener *engine.MirrorListener, link string, info *engine.YtdlInfo, choice *engine.YtdlFormatChoice) error {
+	listener.SetSource(engine.MirrorSourceMedia, link)
+	err := engine.NewYtdlDownload(link, info, choice, listener)
+	if err != nil {
+		engine.SendMessage(opts.B, err.Error(), opts.Message)
+		return nil
+	}
+	HandleSendStatusMessage(opts)
+	if !engine.Spinner.IsRunning() {
+		engine.Spinner.Start(opts.B)
+	}
+	return nil
+}
+
+// prepareYtdl : --quality=best|audio|720 skips the keyboard, so does a link with a single format
+func prepareYtdl(opts *PrepareMirrorOptions, listener *engine.MirrorListener, link string, options map[string]string) error {
+	info, err := engine.ProbeYtdl(link)
+	if err != nil {
+		engine.SendMessage(opts.B, err.Error(), opts.Message)
+		return nil
+	}
+	if quality, ok := options["quality"]; ok {
+		choice, err := engine.ParseYtdlQuality(quality)
+		if err != nil {
+			engine.SendMessage(opts.B, err.Error(), opts.Message)
+			return nil
+		}
+		return startYtdl(opts, listener, link, info, choice)
+	}
+	choices := engine.GetYtdlFormatChoices(info)
+	if len(choices) == 1 {
+		return startYtdl(opts, listener, link, info, choices[0])
+	}
+	id := utils.RandString(8)
+	msg := engine.SendMessageMarkup(opts.B, getYtdlMediaString(info)+"\nChoose a format:", opts.Message, getYtdlFormatMarkup(id, choices))
+	if msg == nil {
+		return nil
+	}
+	ytdlSelectionsMut.Lock()
+	ytdlSelections[id] = &ytdlSelection{
+		opts:     opts,
+		listener: listener,
+		link:     link,
+		info:     info,
+		choices:  choices,
+		userId:   opts.Message.From.Id,
+		message:  msg,
+		timer: time.AfterFunc(ytdlSelectionTimeout, func() {
+			if popYtdlSelection(id) != nil {
+				engine.EditMessage(opts.B, getYtdlMediaString(info)+"\nNo format chosen, mirror dropped.", msg)
+			}
+		}),
+	}
+	ytdlSelectionsMut.Unlock()
+	return nil
+}
+
+func YtdlFormatHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+	data := strings.Split(strings.TrimPrefix(cq.Data, ytdlCallbackPrefix), "_")
+	if len(data) != 2 {
+		return nil
+	}
+	ytdlSelectionsMut.Lock()
+	selection, ok := ytdlSelections[data[0]]
+	ytdlSelectionsMut.Unlock()
+	if !ok {
+		cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "This format selection has expired."})
+		return nil
+	}
+	if selection.userId != cq.From.Id && !utils.IsUserOwner(cq.From.Id) {
+		cq.Answer(b, &gotgbot.AnswerCallbackQueryOpts{Text: "Only the user who started this mirror can choose its format.", ShowAlert: true})
+		return nil
+	}
+	// a double tap must not start the download twice
+	if popYtdlSelection(data[0]) == nil {
+		cq.Answer(b, nil)
+		return nil
+	}
+	cq.Answer(b, nil)
+	if data[1] == "cancel" {
+		engine.EditMessage(b, getYtdlMediaString(selection.info)+"\nCancelled.", selection.message)
+		return nil
+	}
+	index, err := strconv.Atoi(data[1])
+	if err != nil || index < 0 || index >= len(selection.choices) {
+		return nil
+	}
+	choice := selection.choices[index]
+	engine.EditMessage(b, getYtdlMediaString(selection.info)+fmt.Sprintf("\nFormat: <code>%s</code>", choice.Label), selection.message)
+	return startYtdl(selection.opts, selection.listener, selection.link, selection.info, choice)
+}
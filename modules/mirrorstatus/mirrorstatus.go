@@ -3,6 +3,8 @@ package mirrorstatus
 import (
 	"MirrorBotGo/db"
 	"MirrorBotGo/engine"
+	"strings"
+
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
@@ -23,74 +25,81 @@ func MirrorStatusHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	return nil
 }
 
-func MirrorStatusPreviousHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+func getStatusViewForCallback(b *gotgbot.Bot, ctx *ext.Context, handlerName string) (*engine.StatusView, *gotgbot.Message) {
 	cq := ctx.CallbackQuery
 	_, err := cq.Answer(b, nil)
 	if err != nil {
-		engine.L().Errorf("MirrorStatusPreviousHandler: callback: %v", err)
-		return nil
+		engine.L().Errorf("%s: callback: %v", handlerName, err)
+		return nil, nil
 	}
 	statusMsg := engine.GetMessageByChatId(ctx.EffectiveChat.Id)
 	if statusMsg == nil {
-		return nil
+		return nil, nil
 	}
-	if engine.GetAllMirrorsCount() > engine.StatusMessageChunkSize {
-		statusMsg.Date = statusMsg.Date - 1
+	return engine.GetStatusView(ctx.EffectiveChat.Id), statusMsg
+}
+
+func MirrorStatusPreviousHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	view, _ := getStatusViewForCallback(b, ctx, "MirrorStatusPreviousHandler")
+	if view == nil {
+		return nil
 	}
+	view.SetPage(view.GetPage() - 1)
 	engine.UpdateAllMessages(b)
 	return nil
 }
 
 func MirrorStatusFirstHandler(b *gotgbot.Bot, ctx *ext.Context) error {
-	cq := ctx.CallbackQuery
-	_, err := cq.Answer(b, nil)
-	if err != nil {
-		engine.L().Errorf("MirrorStatusFirstHandler: callback: %v", err)
-		return nil
-	}
-	statusMsg := engine.GetMessageByChatId(ctx.EffectiveChat.Id)
-	if statusMsg == nil {
+	view, _ := getStatusViewForCallback(b, ctx, "MirrorStatusFirstHandler")
+	if view == nil {
 		return nil
 	}
-	if engine.GetAllMirrorsCount() > engine.StatusMessageChunkSize {
-		statusMsg.Date = 0
-	}
+	view.SetPage(0)
 	engine.UpdateAllMessages(b)
 	return nil
 }
 
 func MirrorStatusNextHandler(b *gotgbot.Bot, ctx *ext.Context) error {
-	cq := ctx.CallbackQuery
-	_, err := cq.Answer(b, nil)
-	if err != nil {
-		engine.L().Errorf("MirrorStatusNextHandler: callback: %v", err)
+	view, _ := getStatusViewForCallback(b, ctx, "MirrorStatusNextHandler")
+	if view == nil {
 		return nil
 	}
-	statusMsg := engine.GetMessageByChatId(ctx.EffectiveChat.Id)
-	if statusMsg == nil {
-		return nil
-	}
-	if engine.GetAllMirrorsCount() > engine.StatusMessageChunkSize {
-		statusMsg.Date = statusMsg.Date + 1
+	if view.GetPage()+1 < len(view.GetMirrorsChunked(engine.StatusMessageChunkSize)) {
+		view.SetPage(view.GetPage() + 1)
 	}
 	engine.UpdateAllMessages(b)
 	return nil
 }
 
 func MirrorStatusLastHandler(b *gotgbot.Bot, ctx *ext.Context) error {
-	cq := ctx.CallbackQuery
-	_, err := cq.Answer(b, nil)
-	if err != nil {
-		engine.L().Errorf("MirrorStatusLastHandler: callback: %v", err)
+	view, _ := getStatusViewForCallback(b, ctx, "MirrorStatusLastHandler")
+	if view == nil {
 		return nil
 	}
-	statusMsg := engine.GetMessageByChatId(ctx.EffectiveChat.Id)
-	if statusMsg == nil {
+	view.SetPage(len(view.GetMirrorsChunked(engine.StatusMessageChunkSize)) - 1)
+	engine.UpdateAllMessages(b)
+	return nil
+}
+
+func MirrorStatusFilterHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	view, statusMsg := getStatusViewForCallback(b, ctx, "MirrorStatusFilterHandler")
+	if view == nil {
 		return nil
 	}
-	if engine.GetAllMirrorsCount() > engine.StatusMessageChunkSize {
-		statusMsg.Date = int64(len(engine.GetAllMirrorsChunked(engine.StatusMessageChunkSize)) - 1)
+	filter := strings.TrimPrefix(ctx.CallbackQuery.Data, "status_filter_")
+	view.SetFilter(filter, ctx.EffectiveUser.Id)
+	statusMsg.Text = "" //force the keyboard to be redrawn even if the mirror list did not change
+	engine.UpdateAllMessages(b)
+	return nil
+}
+
+func MirrorStatusSortHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	view, statusMsg := getStatusViewForCallback(b, ctx, "MirrorStatusSortHandler")
+	if view == nil {
+		return nil
 	}
+	view.NextSort()
+	statusMsg.Text = ""
 	engine.UpdateAllMessages(b)
 	return nil
 }
@@ -110,4 +119,10 @@ func LoadMirrorStatusHandler(updater *ext.Updater, l *zap.SugaredLogger) {
 	updater.Dispatcher.AddHandler(handlers.NewCallback(func(cq *gotgbot.CallbackQuery) bool {
 		return cq.Data == "last"
 	}, MirrorStatusLastHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCallback(func(cq *gotgbot.CallbackQuery) bool {
+		return cq.Data == "status_filter_all" || cq.Data == "status_filter_chat" || cq.Data == "status_filter_user"
+	}, MirrorStatusFilterHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCallback(func(cq *gotgbot.CallbackQuery) bool {
+		return cq.Data == "status_sort"
+	}, MirrorStatusSortHandler))
 }
@@ -71,14 +71,26 @@ func StatsHandler(b *gotgbot.Bot, ctx *ext.Context) error {
 	out += fmt.Sprintf("RAM: %s\n", GetMemoryUsage())
 	out += fmt.Sprintf("Cores: %d\n", runtime.NumCPU())
 	out += fmt.Sprintf("Goroutines: %d\n", runtime.NumGoroutine())
+	out += engine.GetBackendsString()
 	sysStats := GetMemoryStats()
 	out += sysStats
 	engine.SendMessage(b, out, message)
 	return nil
 }
 
+// HealthHandler : probes every backend instead of showing the supervisor's last results like /stats,
+// owner only since the errors carry internal urls and hostnames
+func HealthHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveMessage.From.Id) {
+		return nil
+	}
+	engine.SendMessage(b, engine.GetBackendsHealthString(), ctx.EffectiveMessage)
+	return nil
+}
+
 func LoadStatsHandler(updater *ext.Updater, l *zap.SugaredLogger) {
 	defer l.Info("Stats Module Loaded.")
 	updater.Dispatcher.AddHandler(handlers.NewCommand("stats", StatsHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("health", HealthHandler))
 	updater.Dispatcher.AddHandler(handlers.NewCommand("profile", ProfileHandler))
 }
@@ -0,0 +1,135 @@
+package tgsession
+
+import (
+	"MirrorBotGo/engine"
+	"MirrorBotGo/utils"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"go.uber.org/zap"
+)
+
+// checkSessionCommand : the login flow carries the phone number, the code and the 2FA password, keep it out of groups
+func checkSessionCommand(b *gotgbot.Bot, ctx *ext.Context) bool {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return false
+	}
+	if ctx.EffectiveChat.Type != "private" {
+		engine.SendMessage(b, "Use this command in a private chat with the bot.", ctx.EffectiveMessage)
+		return false
+	}
+	return true
+}
+
+func getCommandArg(message *gotgbot.Message) string {
+	args := strings.SplitN(message.Text, " ", 2)
+	if len(args) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(args[1])
+}
+
+// deleteCommandMessage : codes and passwords must not stay in the chat
+func deleteCommandMessage(b *gotgbot.Bot, message *gotgbot.Message) {
+	_, err := b.DeleteMessage(message.Chat.Id, message.MessageId, nil)
+	if err != nil {
+		engine.L().Warnf("tgsession: failed to delete command message: %v", err)
+	}
+}
+
+func TgLoginHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !checkSessionCommand(b, ctx) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	phone := getCommandArg(message)
+	if phone == "" {
+		engine.SendMessage(b, "/tglogin {phone number in international format}", message)
+		return nil
+	}
+	err := engine.StartTelegramUserLogin(phone)
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, "Login code sent. Reply with /tgcode followed by the code with spaces between the digits, e.g. <code>/tgcode 1 2 3 4 5</code>, telegram expires codes that are sent unchanged.", message)
+	return nil
+}
+
+func TgCodeHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !checkSessionCommand(b, ctx) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	code := getCommandArg(message)
+	if code == "" {
+		engine.SendMessage(b, "/tgcode {code}", message)
+		return nil
+	}
+	deleteCommandMessage(b, message)
+	needsPassword, err := engine.CompleteTelegramUserLogin(code)
+	if err != nil {
+		engine.SendMessageToChat(b, err.Error(), message)
+		return nil
+	}
+	if needsPassword {
+		engine.SendMessageToChat(b, "The account has two-step verification, send the password with /tgpassword {password}", message)
+		return nil
+	}
+	engine.SendMessageToChat(b, engine.GetTelegramSessionsString(), message)
+	return nil
+}
+
+func TgPasswordHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !checkSessionCommand(b, ctx) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	password := getCommandArg(message)
+	if password == "" {
+		engine.SendMessage(b, "/tgpassword {password}", message)
+		return nil
+	}
+	deleteCommandMessage(b, message)
+	err := engine.CompleteTelegramUserPassword(password)
+	if err != nil {
+		engine.SendMessageToChat(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessageToChat(b, engine.GetTelegramSessionsString(), message)
+	return nil
+}
+
+func TgLogoutHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !checkSessionCommand(b, ctx) {
+		return nil
+	}
+	message := ctx.EffectiveMessage
+	err := engine.LogoutTelegramUser()
+	if err != nil {
+		engine.SendMessage(b, err.Error(), message)
+		return nil
+	}
+	engine.SendMessage(b, "Telegram user session removed.", message)
+	return nil
+}
+
+func TgSessionHandler(b *gotgbot.Bot, ctx *ext.Context) error {
+	if !utils.IsUserOwner(ctx.EffectiveUser.Id) {
+		return nil
+	}
+	engine.SendMessage(b, engine.GetTelegramSessionsString(), ctx.EffectiveMessage)
+	return nil
+}
+
+func LoadTgSessionHandlers(updater *ext.Updater, l *zap.SugaredLogger) {
+	defer l.Info("TgSession Module Loaded.")
+	engine.RestoreTelegramUserSession()
+	updater.Dispatcher.AddHandler(handlers.NewCommand("tglogin", TgLoginHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("tgcode", TgCodeHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("tgpassword", TgPasswordHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("tglogout", TgLogoutHandler))
+	updater.Dispatcher.AddHandler(handlers.NewCommand("tgsession", TgSessionHandler))
+}
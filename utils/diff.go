@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MaxDiffLines : above this many lines per side the LCS table gets too large, only a summary is produced
+const MaxDiffLines = 2000
+
+// LineDiff : minimal line based diff, removed lines are prefixed with "-" and added lines with "+"
+func LineDiff(oldText string, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	var oldLines, newLines []string
+	if oldText != "" {
+		oldLines = strings.Split(oldText, "\n")
+	}
+	if newText != "" {
+		newLines = strings.Split(newText, "\n")
+	}
+	if len(oldLines) > MaxDiffLines || len(newLines) > MaxDiffLines {
+		return fmt.Sprintf("-%d lines\n+%d lines", len(oldLines), len(newLines))
+	}
+	// lcs[i][j] : longest common subsequence of oldLines[i:] and newLines[j:]
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(oldLines) && j < len(newLines) {
+		if oldLines[i] == newLines[j] {
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			out = append(out, "-"+oldLines[i])
+			i++
+		} else {
+			out = append(out, "+"+newLines[j])
+			j++
+		}
+	}
+	for ; i < len(oldLines); i++ {
+		out = append(out, "-"+oldLines[i])
+	}
+	for ; j < len(newLines); j++ {
+		out = append(out, "+"+newLines[j])
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SecretsKeyEnv : environment variable holding the passphrase extractor secrets are encrypted with
+const SecretsKeyEnv = "MIRRORBOT_SECRETS_KEY"
+
+const encryptedSecretPrefix = "enc:v1:"
+
+// getSecretsCipher : the key never lives in config.json so a leaked config or db dump alone reveals nothing
+func getSecretsCipher() (cipher.AEAD, error) {
+	passphrase := os.Getenv(SecretsKeyEnv)
+	if passphrase == "" {
+		return nil, fmt.Errorf("%s is not set, secrets can't be encrypted", SecretsKeyEnv)
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func IsSecretsKeySet() bool {
+	return os.Getenv(SecretsKeyEnv) != ""
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+func EncryptSecret(value string) (string, error) {
+	aead, err := getSecretsCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret : values stored before encryption was introduced are returned as they are
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	aead, err := getSecretsCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("encrypted secret is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret, was %s changed? %v", SecretsKeyEnv, err)
+	}
+	return string(plain), nil
+}
+
+// MaskSecret : only the length is revealed
+func MaskSecret(value string) string {
+	return fmt.Sprintf("•••••• (%d chars)", len(value))
+}
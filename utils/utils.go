@@ -49,47 +49,73 @@ func IsUrlLink(link string) bool {
 }
 
 type ConfigJson struct {
-	BotToken                                    string  `json:"bot_token"`
-	SudoUsers                                   []int64 `json:"sudo_users"`
-	AuthorizedChats                             []int64 `json:"authorized_chats"`
-	OwnerId                                     int64   `json:"owner_id"`
-	DownloadDir                                 string  `json:"download_dir"`
-	IsTeamDrive                                 bool    `json:"is_team_drive"`
-	GdriveParentId                              string  `json:"gdrive_parent_id"`
-	StatusUpdateInterval                        int     `json:"status_update_interval"`
-	AutoDeleteTimeout                           int     `json:"auto_delete_timeout"`
-	DbUri                                       string  `json:"db_uri"`
-	UseSa                                       bool    `json:"use_sa"`
-	IndexUrl                                    string  `json:"index_url"`
-	TgAppId                                     string  `json:"tg_app_id"`
-	TgAppHash                                   string  `json:"tg_app_hash"`
-	MegaEmail                                   string  `json:"mega_email"`
-	MegaPassword                                string  `json:"mega_password"`
-	MegaAPIKey                                  string  `json:"mega_api_key"`
-	MegaSDKRestServiceURL                       string  `json:"mega_sdk_rest_service_url"`
-	StatusMessagesPerPage                       int     `json:"status_messages_per_page"`
-	EncryptionPassword                          string  `json:"encryption_password"`
-	Seed                                        bool    `json:"seed"`
-	HealthCheckRouterURL                        string  `json:"health_check_router_url"`
-	TransferServiceURL                          string  `json:"transfer_service_url"`
-	UsenetClientURL                             string  `json:"usenet_client_url"`
-	UsenetClientUsername                        string  `json:"usenet_client_username"`
-	UsenetClientPassword                        string  `json:"usenet_client_password"`
-	TorrentClientListenPort                     int     `json:"torrent_client_listen_port"`
-	TorrentClientHTTPUserAgent                  string  `json:"torrent_client_http_user_agent"`
-	TorrentClientBep20                          string  `json:"torrent_client_bep_20"`
-	TorrentClientUpnpID                         string  `json:"torrent_client_upnp_id"`
-	TorrentClientMaxUploadRate                  string  `json:"torrent_client_max_upload_rate"`
-	TorrentClientMinDialTimeout                 int     `json:"torrent_client_min_dial_timeout"`
-	TorrentClientEstablishedConnsPerTorrent     int     `json:"torrent_client_established_conns_per_torrent"`
-	TorrentClientExtendedHandshakeClientVersion string  `json:"torrent_client_extended_handshake_client_version"`
-	TorrentUseTrackerList                       bool    `json:"torrent_use_tracker_list"`
-	TorrentTrackerListURL                       string  `json:"torrent_tracker_list_url"`
-	KedgeURL                                    string  `json:"kedge_url"`
-	ZipStreamerURL                              string  `json:"zip_streamer_url"`
-	SpamFilterMessagesPerDuration               int     `json:"spam_filter_messages_per_duration"`
-	SpamFilterDurationValue                     int     `json:"spam_filter_duration_value"`
-	StatusMessageAutoDeleteTime                 int     `json:"status_message_auto_delete_time"`
+	BotToken                                    string   `json:"bot_token"`
+	SudoUsers                                   []int64  `json:"sudo_users"`
+	AuthorizedChats                             []int64  `json:"authorized_chats"`
+	OwnerId                                     int64    `json:"owner_id"`
+	DownloadDir                                 string   `json:"download_dir"`
+	IsTeamDrive                                 bool     `json:"is_team_drive"`
+	GdriveParentId                              string   `json:"gdrive_parent_id"`
+	StatusUpdateInterval                        int      `json:"status_update_interval"`
+	AutoDeleteTimeout                           int      `json:"auto_delete_timeout"`
+	DbUri                                       string   `json:"db_uri"`
+	UseSa                                       bool     `json:"use_sa"`
+	IndexUrl                                    string   `json:"index_url"`
+	TgAppId                                     string   `json:"tg_app_id"`
+	TgAppHash                                   string   `json:"tg_app_hash"`
+	MegaEmail                                   string   `json:"mega_email"`
+	MegaPassword                                string   `json:"mega_password"`
+	MegaAPIKey                                  string   `json:"mega_api_key"`
+	MegaSDKRestServiceURL                       string   `json:"mega_sdk_rest_service_url"`
+	StatusMessagesPerPage                       int      `json:"status_messages_per_page"`
+	EncryptionPassword                          string   `json:"encryption_password"`
+	Seed                                        bool     `json:"seed"`
+	HealthCheckRouterURL                        string   `json:"health_check_router_url"`
+	TransferServiceURL                          string   `json:"transfer_service_url"`
+	UsenetClientURL                             string   `json:"usenet_client_url"`
+	UsenetClientUsername                        string   `json:"usenet_client_username"`
+	UsenetClientPassword                        string   `json:"usenet_client_password"`
+	TorrentClientListenPort                     int      `json:"torrent_client_listen_port"`
+	TorrentClientHTTPUserAgent                  string   `json:"torrent_client_http_user_agent"`
+	TorrentClientBep20                          string   `json:"torrent_client_bep_20"`
+	TorrentClientUpnpID                         string   `json:"torrent_client_upnp_id"`
+	TorrentClientMaxUploadRate                  string   `json:"torrent_client_max_upload_rate"`
+	TorrentClientMinDialTimeout                 int      `json:"torrent_client_min_dial_timeout"`
+	TorrentClientEstablishedConnsPerTorrent     int      `json:"torrent_client_established_conns_per_torrent"`
+	TorrentClientExtendedHandshakeClientVersion string   `json:"torrent_client_extended_handshake_client_version"`
+	TorrentUseTrackerList                       bool     `json:"torrent_use_tracker_list"`
+	TorrentTrackerListURL                       string   `json:"torrent_tracker_list_url"`
+	TorrentEngine                               string   `json:"torrent_engine"`
+	KedgeURL                                    string   `json:"kedge_url"`
+	ZipStreamerURL                              string   `json:"zip_streamer_url"`
+	SpamFilterMessagesPerDuration               int      `json:"spam_filter_messages_per_duration"`
+	SpamFilterDurationValue                     int      `json:"spam_filter_duration_value"`
+	StatusMessageAutoDeleteTime                 int      `json:"status_message_auto_delete_time"`
+	SeedRatioLimit                              float64  `json:"seed_ratio_limit"`
+	SeedTimeLimit                               int      `json:"seed_time_limit"`
+	SeedMinTime                                 int      `json:"seed_min_time"`
+	JSTimeout                                   int      `json:"js_timeout"`
+	JSMaxRequests                               int      `json:"js_max_requests"`
+	JSMaxResponseSize                           string   `json:"js_max_response_size"`
+	JSMaxRequestBodySize                        string   `json:"js_max_request_body_size"`
+	JSAllowedHosts                              []string `json:"js_allowed_hosts"`
+	JSDeniedHosts                               []string `json:"js_denied_hosts"`
+	JSAllowPrivateHosts                         bool     `json:"js_allow_private_hosts"`
+	JSSleepBudget                               int      `json:"js_sleep_budget"`
+	JSMaxMemory                                 string   `json:"js_max_memory"`
+	HttpUserAgent                               string   `json:"http_user_agent"`
+	HttpProxy                                   string   `json:"http_proxy"`
+	HttpConnections                             int      `json:"http_connections"`
+	HttpMaxConnections                          int      `json:"http_max_connections"`
+	SftpKnownHostsFile                          string   `json:"sftp_known_hosts_file"`
+	YtdlPath                                    string   `json:"ytdl_path"`
+	YtdlHosts                                   []string `json:"ytdl_hosts"`
+	YtdlExtraArgs                               []string `json:"ytdl_extra_args"`
+	TgUserSessionFile                           string   `json:"tg_user_session_file"`
+	GotdMaxPartRequests                         int      `json:"gotd_max_part_requests"`
+	TgPartialDir                                string   `json:"tg_partial_dir"`
+	TgPartialMaxAge                             int      `json:"tg_partial_max_age"`
+	BackendCheckInterval                        int      `json:"backend_check_interval"`
 }
 
 var Config *ConfigJson = InitConfig()
@@ -131,6 +157,19 @@ func GetSudoUsers() []int64 {
 	return Config.SudoUsers
 }
 
+const (
+	TorrentEngineKedge  string = "kedge"
+	TorrentEngineNative string = "native"
+)
+
+// GetTorrentEngine : "kedge" (external service, default) or "native" (in-process anacrolix/torrent client)
+func GetTorrentEngine() string {
+	if strings.ToLower(Config.TorrentEngine) == TorrentEngineNative {
+		return TorrentEngineNative
+	}
+	return TorrentEngineKedge
+}
+
 func GetKedgeURL() string {
 	if Config.KedgeURL == "" {
 		return "http://localhost:16180/api"
@@ -157,6 +196,14 @@ func GetHealthCheckRouterURL() string {
 	return Config.HealthCheckRouterURL
 }
 
+// GetBackendCheckInterval : how often nzbget, kedge, the transfer service and the mega service are checked, in seconds
+func GetBackendCheckInterval() time.Duration {
+	if Config.BackendCheckInterval <= 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(Config.BackendCheckInterval) * time.Second
+}
+
 func GetTransferServiceURL() string {
 	if Config.TransferServiceURL == "" {
 		return "http://127.0.0.1:6969/api/v1"
@@ -231,6 +278,68 @@ func GetTorrentClientMaxUploadRate() (uint64, error) {
 	return humanize.ParseBytes(Config.TorrentClientMaxUploadRate)
 }
 
+// GetJSTimeout : execution deadline of a single extractor script run
+func GetJSTimeout() time.Duration {
+	if Config.JSTimeout == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(Config.JSTimeout) * time.Second
+}
+
+func GetJSMaxRequests() int {
+	if Config.JSMaxRequests == 0 {
+		return 20
+	}
+	return Config.JSMaxRequests
+}
+
+func GetJSMaxResponseSize() int64 {
+	size, err := humanize.ParseBytes(Config.JSMaxResponseSize)
+	if err != nil || size == 0 {
+		return 10 * 1024 * 1024
+	}
+	return int64(size)
+}
+
+func GetJSMaxRequestBodySize() int64 {
+	size, err := humanize.ParseBytes(Config.JSMaxRequestBodySize)
+	if err != nil || size == 0 {
+		return 1024 * 1024
+	}
+	return int64(size)
+}
+
+func GetJSAllowedHosts() []string {
+	return Config.JSAllowedHosts
+}
+
+func GetJSDeniedHosts() []string {
+	return Config.JSDeniedHosts
+}
+
+// GetJSAllowPrivateHosts : lets scripts reach loopback and private ranges, off by default
+func GetJSAllowPrivateHosts() bool {
+	return Config.JSAllowPrivateHosts
+}
+
+// GetJSSleepBudget : total time a single script run may spend in sleep()
+func GetJSSleepBudget() time.Duration {
+	if Config.JSSleepBudget == 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(Config.JSSleepBudget) * time.Second
+}
+
+// GetJSMaxMemory : how much the heap of the whole process may grow while a script runs, 0 turns the limit off,
+// downloads running at the same time count against it too
+func GetJSMaxMemory() int64 {
+	size, err := humanize.ParseBytes(Config.JSMaxMemory)
+	if err != nil {
+		return 0
+	}
+	return int64(size)
+}
+
 func GetStatusMessagesPerPage() int {
 	if Config.StatusMessagesPerPage == 0 {
 		return 5
@@ -293,6 +402,21 @@ func GetSeed() bool {
 	return Config.Seed
 }
 
+// GetSeedRatioLimit : upload/download ratio after which seeding stops, 0 means no limit
+func GetSeedRatioLimit() float64 {
+	return Config.SeedRatioLimit
+}
+
+// GetSeedTimeLimit : seeding duration after which seeding stops, 0 means no limit
+func GetSeedTimeLimit() time.Duration {
+	return time.Duration(Config.SeedTimeLimit) * time.Minute
+}
+
+// GetSeedMinTime : minimum seeding duration before any limit is allowed to stop the seed
+func GetSeedMinTime() time.Duration {
+	return time.Duration(Config.SeedMinTime) * time.Minute
+}
+
 func GetDownloadDir() string {
 	return Config.DownloadDir
 }
@@ -331,7 +455,88 @@ func GetTorrentClientHTTPUserAgent() string {
 }
 
 func GetHttpUserAgent() string {
-	return "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.102 Safari/537.36"
+	if Config.HttpUserAgent == "" {
+		return "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/85.0.4183.102 Safari/537.36"
+	}
+	return Config.HttpUserAgent
+}
+
+// GetHttpProxy : empty means the proxy from the environment is used
+func GetHttpProxy() string {
+	return Config.HttpProxy
+}
+
+func GetHttpConnections() int {
+	if Config.HttpConnections == 0 {
+		return 10
+	}
+	return Config.HttpConnections
+}
+
+// GetSftpKnownHostsFile : empty pins the key of each host on first connect and refuses it if it changes
+func GetSftpKnownHostsFile() string {
+	return Config.SftpKnownHostsFile
+}
+
+// GetYtdlPath : yt-dlp or a compatible binary, looked up in PATH unless absolute
+func GetYtdlPath() string {
+	if Config.YtdlPath == "" {
+		return "yt-dlp"
+	}
+	return Config.YtdlPath
+}
+
+// GetYtdlHosts : /mirror hands links on these hosts or their subdomains to yt-dlp instead of downloading the page
+func GetYtdlHosts() []string {
+	if Config.YtdlHosts == nil {
+		return []string{"youtube.com", "youtu.be", "vimeo.com", "dailymotion.com", "twitch.tv", "soundcloud.com", "bandcamp.com", "twitter.com", "x.com", "reddit.com", "instagram.com", "tiktok.com", "facebook.com"}
+	}
+	return Config.YtdlHosts
+}
+
+// GetYtdlExtraArgs : appended to every yt-dlp invocation, e.g. --cookies or --ffmpeg-location
+func GetYtdlExtraArgs() []string {
+	return Config.YtdlExtraArgs
+}
+
+// GetTgUserSessionFile : where the encrypted session of the optional telegram user login is kept
+func GetTgUserSessionFile() string {
+	if Config.TgUserSessionFile == "" {
+		return "user.session"
+	}
+	return Config.TgUserSessionFile
+}
+
+// GetTgPartialDir : partial telegram downloads are kept here to be resumed, outside the download dir which is wiped on exit
+func GetTgPartialDir() string {
+	if Config.TgPartialDir == "" {
+		return "tg_partial"
+	}
+	return Config.TgPartialDir
+}
+
+// GetTgPartialMaxAge : partial telegram downloads untouched for longer are removed, in hours
+func GetTgPartialMaxAge() time.Duration {
+	if Config.TgPartialMaxAge <= 0 {
+		return 24 * time.Hour
+	}
+	return time.Duration(Config.TgPartialMaxAge) * time.Hour
+}
+
+// GetGotdMaxPartRequests : part requests in flight across all telegram downloads, telegram answers more with FLOOD_WAIT
+func GetGotdMaxPartRequests() int {
+	if Config.GotdMaxPartRequests <= 0 {
+		return 16
+	}
+	return Config.GotdMaxPartRequests
+}
+
+// GetHttpMaxConnections : upper bound for the per mirror --connections option
+func GetHttpMaxConnections() int {
+	if Config.HttpMaxConnections == 0 {
+		return 32
+	}
+	return Config.HttpMaxConnections
 }
 
 func IsTeamDrive() bool {
@@ -368,6 +573,70 @@ func ParseMessageArgs(m string) string {
 	return ""
 }
 
+// splitMessageFields : like strings.Fields but double quotes keep spaces together, --header="X-A: b" is one field
+func splitMessageFields(args string) []string {
+	var fields []string
+	var field strings.Builder
+	inQuotes := false
+	hasField := false
+	for _, r := range args {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case !inQuotes && (r == ' ' || r == '\t' || r == '\n'):
+			if hasField {
+				fields = append(fields, field.String())
+				field.Reset()
+				hasField = false
+			}
+		default:
+			field.WriteRune(r)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// ParseMessageOptions : --key=value and --key flags, values may be quoted and repeated keys are joined with a newline
+func ParseMessageOptions(args string) (string, map[string]string) {
+	options := make(map[string]string)
+	var rest []string
+	for _, field := range splitMessageFields(args) {
+		if !strings.HasPrefix(field, "--") || len(field) == 2 {
+			rest = append(rest, field)
+			continue
+		}
+		data := strings.SplitN(strings.TrimPrefix(field, "--"), "=", 2)
+		key := strings.ToLower(data[0])
+		value := "true"
+		if len(data) > 1 {
+			value = data[1]
+		}
+		if previous, ok := options[key]; ok {
+			value = previous + "\n" + value
+		}
+		options[key] = value
+	}
+	return strings.Join(rest, " "), options
+}
+
+var credentialsInUrlRegex = regexp.MustCompile(`(://)[^/\s@:]+:[^/\s@]*@`)
+var credentialOptionsRegex = regexp.MustCompile(`(?i)(--(?:header|cookie|user|auth)=)("[^"]*"|\S+)`)
+
+// credentialsInQueryRegex : api keys of nzb indexers, r is the key parameter of newznab and nzedb download links
+var credentialsInQueryRegex = regexp.MustCompile(`(?i)([?&](?:apikey|api_key|r)=)[^&\s]+`)
+
+// RedactCredentials : hides url userinfo, indexer api keys and the values of credential carrying options before text is logged or shown
+func RedactCredentials(text string) string {
+	text = credentialsInUrlRegex.ReplaceAllString(text, "${1}<redacted>@")
+	text = credentialsInQueryRegex.ReplaceAllString(text, "${1}<redacted>")
+	return credentialOptionsRegex.ReplaceAllString(text, "${1}<redacted>")
+}
+
 func RemoveByPath(pth string) error {
 	return os.RemoveAll(pth)
 }